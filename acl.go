@@ -0,0 +1,556 @@
+package redisnats
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/henomis/redis2nats/nats"
+)
+
+const (
+	aclCategoryPrefix = "@"
+	aclCategoryAll    = "all"
+	aclAllKeys        = "*"
+	aclUserPrefix     = "user"
+)
+
+// noAuthCommands are the commands that can be run by clients that did not authenticate.
+var noAuthCommands = map[string]struct{}{
+	"AUTH":  {},
+	"HELLO": {},
+}
+
+// aclCommandRule allows or denies a command or a category of commands.
+type aclCommandRule struct {
+	allow bool
+	// name is a lowercase command name, or a category prefixed with @.
+	name string
+}
+
+func (r aclCommandRule) String() string {
+	if r.allow {
+		return "+" + r.name
+	}
+
+	return "-" + r.name
+}
+
+// aclUser is a user with its credentials and permissions.
+type aclUser struct {
+	name    string
+	enabled bool
+	nopass  bool
+	// passwords are the SHA-256 hashes of the passwords, hex encoded.
+	passwords    []string
+	keyPatterns  []string
+	commandRules []aclCommandRule
+}
+
+// acl holds the users shared by all the clients of the server.
+type acl struct {
+	m     sync.RWMutex
+	users map[string]*aclUser
+}
+
+// newACL creates the users from the legacy password of the default user and
+// from the users in ACL file format (user <username> <rules>...).
+func newACL(password string, users []string) (*acl, error) {
+	a := &acl{
+		users: map[string]*aclUser{
+			defaultUser: {
+				name:         defaultUser,
+				enabled:      true,
+				nopass:       true,
+				keyPatterns:  []string{aclAllKeys},
+				commandRules: []aclCommandRule{{allow: true, name: aclCategoryPrefix + aclCategoryAll}},
+			},
+		},
+	}
+
+	if password != "" {
+		err := a.setUser(defaultUser, "resetpass", ">"+password)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, user := range users {
+		fields := strings.Fields(user)
+		if len(fields) < 2 || fields[0] != aclUserPrefix {
+			return nil, fmt.Errorf("%w: %s", ErrACLUserDefinition, user)
+		}
+
+		err := a.setUser(fields[1], fields[2:]...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return a, nil
+}
+
+// initialUser returns the user of a new connection: the default user if it
+// does not require a password, no user otherwise.
+func (a *acl) initialUser() string {
+	a.m.RLock()
+	defer a.m.RUnlock()
+
+	user := a.users[defaultUser]
+	if user != nil && user.enabled && user.nopass {
+		return defaultUser
+	}
+
+	return ""
+}
+
+// authenticate checks the password of the user.
+func (a *acl) authenticate(username, password string) bool {
+	a.m.RLock()
+	defer a.m.RUnlock()
+
+	user, ok := a.users[username]
+	if !ok || !user.enabled {
+		return false
+	}
+
+	if user.nopass {
+		return true
+	}
+
+	hash := hashPassword(password)
+	for _, passwordHash := range user.passwords {
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(passwordHash)) == 1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// enabled reports whether the user exists and is enabled.
+func (a *acl) enabled(username string) bool {
+	a.m.RLock()
+	defer a.m.RUnlock()
+
+	user, ok := a.users[username]
+	return ok && user.enabled
+}
+
+// authorize checks that the user can run the command on the keys.
+func (a *acl) authorize(username string, commandName string, spec redisCommandSpec, keys []string) error {
+	a.m.RLock()
+	defer a.m.RUnlock()
+
+	user, ok := a.users[username]
+	if !ok || !user.enabled {
+		return ErrNoAuth
+	}
+
+	if !user.canRun(strings.ToLower(commandName), spec) {
+		return noPermissionError(username, strings.ToLower(commandName))
+	}
+
+	for _, key := range keys {
+		if !user.canAccess(key) {
+			return ErrNoPermissionKey
+		}
+	}
+
+	return nil
+}
+
+// setUser creates the user if it does not exist and applies the rules.
+// The user is not modified if any rule is invalid.
+func (a *acl) setUser(username string, rules ...string) error {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	user := &aclUser{name: username}
+	if existing, ok := a.users[username]; ok {
+		user = existing.clone()
+	}
+
+	for _, rule := range rules {
+		err := user.applyRule(rule)
+		if err != nil {
+			return err
+		}
+	}
+
+	a.users[username] = user
+
+	return nil
+}
+
+// getUser returns a copy of the user.
+func (a *acl) getUser(username string) (*aclUser, bool) {
+	a.m.RLock()
+	defer a.m.RUnlock()
+
+	user, ok := a.users[username]
+	if !ok {
+		return nil, false
+	}
+
+	return user.clone(), true
+}
+
+// delUsers deletes the users and returns the number of deleted users.
+func (a *acl) delUsers(usernames ...string) (int, error) {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	if slices.Contains(usernames, defaultUser) {
+		return 0, ErrACLDeleteDefaultUser
+	}
+
+	deleted := 0
+	for _, username := range usernames {
+		if _, ok := a.users[username]; ok {
+			delete(a.users, username)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+// list returns the users in ACL file format, sorted by name.
+func (a *acl) list() []string {
+	a.m.RLock()
+	defer a.m.RUnlock()
+
+	users := make([]string, 0, len(a.users))
+	for _, user := range a.users {
+		users = append(users, user.String())
+	}
+
+	sort.Strings(users)
+
+	return users
+}
+
+func (u *aclUser) clone() *aclUser {
+	return &aclUser{
+		name:         u.name,
+		enabled:      u.enabled,
+		nopass:       u.nopass,
+		passwords:    slices.Clone(u.passwords),
+		keyPatterns:  slices.Clone(u.keyPatterns),
+		commandRules: slices.Clone(u.commandRules),
+	}
+}
+
+// applyRule applies an ACL SETUSER rule to the user.
+// nolint:gocognit,cyclop
+func (u *aclUser) applyRule(rule string) error {
+	switch lowerRule := strings.ToLower(rule); {
+	case lowerRule == "on":
+		u.enabled = true
+	case lowerRule == "off":
+		u.enabled = false
+	case lowerRule == "nopass":
+		u.nopass = true
+		u.passwords = nil
+	case lowerRule == "resetpass":
+		u.nopass = false
+		u.passwords = nil
+	case lowerRule == "allkeys":
+		u.keyPatterns = []string{aclAllKeys}
+	case lowerRule == "resetkeys":
+		u.keyPatterns = nil
+	case lowerRule == "allcommands":
+		u.commandRules = []aclCommandRule{{allow: true, name: aclCategoryPrefix + aclCategoryAll}}
+	case lowerRule == "nocommands":
+		u.commandRules = nil
+	case lowerRule == "reset":
+		u.enabled, u.nopass = false, false
+		u.passwords, u.keyPatterns, u.commandRules = nil, nil, nil
+	case strings.HasPrefix(rule, ">"):
+		u.nopass = false
+		u.addPassword(hashPassword(rule[1:]))
+	case strings.HasPrefix(rule, "<"):
+		u.removePassword(hashPassword(rule[1:]))
+	case strings.HasPrefix(rule, "#"):
+		if !isPasswordHash(rule[1:]) {
+			return ACLRuleError{Rule: rule, Message: "The password hash must be exactly 64 characters and contain only lowercase hexadecimal characters"}
+		}
+		u.nopass = false
+		u.addPassword(rule[1:])
+	case strings.HasPrefix(rule, "!"):
+		u.removePassword(rule[1:])
+	case strings.HasPrefix(rule, "~"):
+		if !slices.Contains(u.keyPatterns, rule[1:]) {
+			u.keyPatterns = append(u.keyPatterns, rule[1:])
+		}
+	case strings.HasPrefix(rule, "+"), strings.HasPrefix(rule, "-"):
+		name := strings.ToLower(rule[1:])
+		if !isKnownCommandOrCategory(name) {
+			return ACLRuleError{Rule: rule, Message: "Unknown command or category name in ACL"}
+		}
+
+		// +@all and -@all override all the previous rules
+		if name == aclCategoryPrefix+aclCategoryAll {
+			u.commandRules = nil
+			if rule[0] == '-' {
+				break
+			}
+		}
+
+		u.commandRules = append(u.commandRules, aclCommandRule{allow: rule[0] == '+', name: name})
+	default:
+		return ACLRuleError{Rule: rule, Message: "Syntax error"}
+	}
+
+	return nil
+}
+
+func (u *aclUser) addPassword(hash string) {
+	if !slices.Contains(u.passwords, hash) {
+		u.passwords = append(u.passwords, hash)
+	}
+}
+
+func (u *aclUser) removePassword(hash string) {
+	u.passwords = slices.DeleteFunc(u.passwords, func(passwordHash string) bool {
+		return passwordHash == hash
+	})
+}
+
+// canRun reports whether the user can run the command.
+// Rules are evaluated in order, so the last matching rule wins.
+func (u *aclUser) canRun(commandName string, spec redisCommandSpec) bool {
+	allowed := false
+	for _, rule := range u.commandRules {
+		if rule.name == commandName || rule.name == aclCategoryPrefix+aclCategoryAll || spec.hasCategory(rule.name) {
+			allowed = rule.allow
+		}
+	}
+
+	return allowed
+}
+
+// canAccess reports whether the user can access the key.
+func (u *aclUser) canAccess(key string) bool {
+	for _, pattern := range u.keyPatterns {
+		if nats.MatchPattern(key, pattern) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// flags returns the flags of the user, as reported by ACL GETUSER.
+func (u *aclUser) flags() []string {
+	flags := []string{"off"}
+	if u.enabled {
+		flags[0] = "on"
+	}
+
+	if u.nopass {
+		flags = append(flags, "nopass")
+	}
+
+	return flags
+}
+
+// commands returns the command rules of the user, as reported by ACL GETUSER.
+func (u *aclUser) commands() string {
+	rules := []string{"-" + aclCategoryPrefix + aclCategoryAll}
+	if len(u.commandRules) > 0 && u.commandRules[0].name == aclCategoryPrefix+aclCategoryAll {
+		rules = nil
+	}
+
+	for _, rule := range u.commandRules {
+		rules = append(rules, rule.String())
+	}
+
+	return strings.Join(rules, " ")
+}
+
+// keys returns the key patterns of the user, as reported by ACL GETUSER.
+func (u *aclUser) keys() string {
+	patterns := make([]string, 0, len(u.keyPatterns))
+	for _, pattern := range u.keyPatterns {
+		patterns = append(patterns, "~"+pattern)
+	}
+
+	return strings.Join(patterns, " ")
+}
+
+// String returns the user in ACL file format.
+func (u *aclUser) String() string {
+	parts := []string{aclUserPrefix, u.name}
+	parts = append(parts, u.flags()...)
+
+	for _, passwordHash := range u.passwords {
+		parts = append(parts, "#"+passwordHash)
+	}
+
+	if keys := u.keys(); keys != "" {
+		parts = append(parts, keys)
+	} else {
+		parts = append(parts, "resetkeys")
+	}
+
+	parts = append(parts, u.commands())
+
+	return strings.Join(parts, " ")
+}
+
+// hashPassword returns the SHA-256 hash of the password, hex encoded.
+func hashPassword(password string) string {
+	hash := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(hash[:])
+}
+
+func isPasswordHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+
+	for i := 0; i < len(hash); i++ {
+		if !isHexDigit(hash[i]) || (hash[i] >= 'A' && hash[i] <= 'F') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// aclCategories are the categories of commands that can be used in ACL rules.
+var aclCategories = []string{
+	"admin", "connection", "dangerous", "fast", "hash", "keyspace",
+	"list", "read", "slow", "string", "transaction", "write",
+}
+
+// isKnownCommandOrCategory reports whether the lowercase name is a supported command or an ACL category.
+func isKnownCommandOrCategory(name string) bool {
+	if category, ok := strings.CutPrefix(name, aclCategoryPrefix); ok {
+		return category == aclCategoryAll || slices.Contains(aclCategories, category)
+	}
+
+	_, ok := redisCommands[strings.ToUpper(name)]
+	return ok
+}
+
+// authorize checks that the client is authenticated and allowed to run the command on its keys.
+func (c *Command) authorize(commandName string, cmd redisCommandSpec, commandParts []string) error {
+	if _, ok := noAuthCommands[commandName]; ok {
+		return nil
+	}
+
+	if c.session.user == "" {
+		return ErrNoAuth
+	}
+
+	return c.acl.authorize(c.session.user, commandName, cmd, cmd.keys(commandParts))
+}
+
+// authenticateAs authenticates the client as the user, if it exists and is enabled,
+// without checking its password. It is used for TLS client certificates.
+func (c *Command) authenticateAs(username string) {
+	if c.acl.enabled(username) {
+		c.session.user = username
+	}
+}
+
+// cmdAuth authenticates the client.
+// syntax: AUTH [username] password
+func (c *Command) cmdAuth(_ context.Context, args ...string) (string, error) {
+	username := defaultUser
+	password := args[0]
+
+	switch len(args) {
+	case 1:
+		if c.acl.initialUser() == defaultUser {
+			return redisNOP, ErrAuthNoPassword
+		}
+	case 2:
+		username, password = args[0], args[1]
+	default:
+		return redisNOP, ErrSyntax
+	}
+
+	if !c.acl.authenticate(username, password) {
+		return redisNOP, ErrWrongPass
+	}
+
+	c.session.user = username
+
+	return redisOK, nil
+}
+
+// cmdACL manages the users and their permissions.
+// supported subcommands: SETUSER, GETUSER, DELUSER, LIST, WHOAMI, CAT
+// nolint:cyclop
+func (c *Command) cmdACL(_ context.Context, args ...string) (string, error) {
+	subcommandName := args[0]
+	subcommand := strings.ToUpper(subcommandName)
+	args = args[1:]
+
+	switch {
+	case subcommand == "SETUSER" && len(args) >= 1:
+		err := c.acl.setUser(args[0], args[1:]...)
+		if err != nil {
+			return redisNOP, err
+		}
+
+		return redisOK, nil
+	case subcommand == "GETUSER" && len(args) == 1:
+		user, ok := c.acl.getUser(args[0])
+		if !ok {
+			return c.reply().NullBulk(), nil
+		}
+
+		reply := c.reply()
+
+		return reply.Map(
+			reply.BulkString("flags"), reply.ArrayOfStrings(user.flags()...),
+			reply.BulkString("passwords"), reply.ArrayOfStrings(user.passwords...),
+			reply.BulkString("commands"), reply.BulkString(user.commands()),
+			reply.BulkString("keys"), reply.BulkString(user.keys()),
+		), nil
+	case subcommand == "DELUSER" && len(args) >= 1:
+		deleted, err := c.acl.delUsers(args...)
+		if err != nil {
+			return redisNOP, err
+		}
+
+		return c.reply().Integer(int64(deleted)), nil
+	case subcommand == "LIST" && len(args) == 0:
+		return c.reply().ArrayOfStrings(c.acl.list()...), nil
+	case subcommand == "WHOAMI" && len(args) == 0:
+		return c.reply().BulkString(c.session.user), nil
+	case subcommand == "CAT" && len(args) == 0:
+		return c.reply().ArrayOfStrings(aclCategories...), nil
+	case subcommand == "CAT" && len(args) == 1:
+		category := strings.ToLower(args[0])
+		if !slices.Contains(aclCategories, category) {
+			return redisNOP, fmt.Errorf("%w '%s'", ErrUnknownCategory, args[0])
+		}
+
+		var commands []string
+		for name, cmd := range redisCommands {
+			if cmd.hasCategory(aclCategoryPrefix + category) {
+				commands = append(commands, strings.ToLower(name))
+			}
+		}
+
+		sort.Strings(commands)
+
+		return c.reply().ArrayOfStrings(commands...), nil
+	case slices.Contains([]string{"SETUSER", "GETUSER", "DELUSER", "LIST", "WHOAMI", "CAT"}, subcommand):
+		return redisNOP, WrongNumArgsError{Command: "acl|" + subcommand}
+	default:
+		return redisNOP, UnknownSubcommandError{Command: "ACL", Subcommand: subcommandName}
+	}
+}
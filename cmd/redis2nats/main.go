@@ -5,10 +5,12 @@ import (
 	"flag"
 	"log/slog"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	redisnats "github.com/henomis/redis2nats"
+	"github.com/henomis/redis2nats/nats"
 	"github.com/spf13/viper"
 )
 
@@ -48,27 +50,122 @@ func main() {
 	viper.SetDefault("nats.url", "nats://localhost:4222")
 	viper.SetDefault("nats.bucketPrefix", "redisnats")
 	viper.SetDefault("nats.timeout", 10*time.Second)
-	viper.SetDefault("nats.persist", false)
+	viper.SetDefault("nats.startupMode", "keep")
+	viper.SetDefault("nats.keyEncoding", "escape")
+	viper.SetDefault("nats.name", "redis2nats")
+	viper.SetDefault("nats.reconnectWait", 2*time.Second)
+	viper.SetDefault("nats.maxReconnects", 60)
+	viper.SetDefault("nats.pingInterval", 2*time.Minute)
+	viper.SetDefault("nats.bucket.replicas", 1)
+	viper.SetDefault("nats.bucket.storage", "file")
+	viper.SetDefault("nats.bucket.history", 1)
+	viper.SetDefault("nats.bucket.compression", false)
+	viper.SetDefault("nats.bucket.reconcile", false)
 	viper.SetDefault("redis.address", ":6379")
 	viper.SetDefault("redis.numDB", 16)
+	viper.SetDefault("redis.pipelineConcurrency", false)
+	viper.SetDefault("redis.pipelineMaxConcurrency", 64)
+	viper.SetDefault("redis.password", "")
+	viper.SetDefault("redis.users", []string{})
+	viper.SetDefault("redis.tls.enabled", false)
+	viper.SetDefault("redis.tls.authClients", "yes")
+	viper.SetDefault("redis.tls.minVersion", "1.2")
 
 	// Retrieve configuration from environment variables
 	natsURL := viper.GetString("nats.url")
 	natsBucketPrefix := viper.GetString("nats.bucketPrefix")
 	natsTimeout := viper.GetDuration("nats.timeout")
-	natsPersist := viper.GetBool("nats.persist")
+	natsStartupMode := viper.GetString("nats.startupMode")
+	natsKeyEncoding := viper.GetString("nats.keyEncoding")
+	if viper.IsSet("nats.persist") {
+		log.Warn("nats.persist is no longer supported and is ignored, use nats.startupMode")
+	}
+	natsOptions := nats.Options{
+		Name:          viper.GetString("nats.name"),
+		CredsFile:     viper.GetString("nats.credsFile"),
+		NKeyFile:      viper.GetString("nats.nkeyFile"),
+		User:          viper.GetString("nats.user"),
+		Password:      viper.GetString("nats.password"),
+		Token:         viper.GetString("nats.token"),
+		TLSCertFile:   viper.GetString("nats.tls.cert"),
+		TLSKeyFile:    viper.GetString("nats.tls.key"),
+		TLSCAFile:     viper.GetString("nats.tls.ca"),
+		ReconnectWait: viper.GetDuration("nats.reconnectWait"),
+		MaxReconnects: viper.GetInt("nats.maxReconnects"),
+		PingInterval:  viper.GetDuration("nats.pingInterval"),
+	}
+	natsBucket := nats.BucketConfig{
+		Replicas:     viper.GetInt("nats.bucket.replicas"),
+		Storage:      viper.GetString("nats.bucket.storage"),
+		MaxBytes:     viper.GetInt64("nats.bucket.maxBytes"),
+		MaxValueSize: viper.GetInt32("nats.bucket.maxValueSize"),
+		History:      uint8(viper.GetUint("nats.bucket.history")), // nolint:gosec
+		Compression:  viper.GetBool("nats.bucket.compression"),
+		Placement: nats.BucketPlacement{
+			Cluster: viper.GetString("nats.bucket.placement.cluster"),
+			Tags:    viper.GetStringSlice("nats.bucket.placement.tags"),
+		},
+		Description: viper.GetString("nats.bucket.description"),
+		Reconcile:   viper.GetBool("nats.bucket.reconcile"),
+	}
+
+	// Databases override the bucket configuration settings they define
+	natsDBBuckets := make(map[int]nats.BucketConfig)
+	for dbID := range viper.GetStringMap("nats.databases") {
+		dbIDAsInt, err := strconv.Atoi(dbID)
+		if err != nil {
+			log.Error("Invalid database ID", "db", dbID)
+			os.Exit(1)
+		}
+
+		bucketConfig := natsBucket
+		err = viper.UnmarshalKey("nats.databases."+dbID+".bucket", &bucketConfig)
+		if err != nil {
+			log.Error("Error reading bucket configuration", "db", dbID, "error", err)
+			os.Exit(1)
+		}
+
+		natsDBBuckets[dbIDAsInt] = bucketConfig
+	}
+
 	redisURL := viper.GetString("redis.address")
 	redisNumDB := viper.GetInt("redis.numDB")
+	redisPipelineConcurrency := viper.GetBool("redis.pipelineConcurrency")
+	redisPipelineMaxConcurrency := viper.GetInt("redis.pipelineMaxConcurrency")
+	redisPassword := viper.GetString("redis.password")
+	redisUsers := viper.GetStringSlice("redis.users")
+
+	var redisTLS *redisnats.TLSConfig
+	if viper.GetBool("redis.tls.enabled") {
+		redisTLS = &redisnats.TLSConfig{
+			CertFile:        viper.GetString("redis.tls.cert"),
+			KeyFile:         viper.GetString("redis.tls.key"),
+			CAFile:          viper.GetString("redis.tls.ca"),
+			AuthClients:     viper.GetString("redis.tls.authClients"),
+			MinVersion:      viper.GetString("redis.tls.minVersion"),
+			CipherSuites:    viper.GetStringSlice("redis.tls.cipherSuites"),
+			AuthClientsUser: viper.GetString("redis.tls.authClientsUser"),
+		}
+	}
 
 	// Create and start the fake Redis server using environment variable for Redis URL
 	fakeRedis := redisnats.NewRedisServer(
 		&redisnats.Config{
-			NATSURL:          natsURL,
-			NATSTimeout:      natsTimeout,
-			NATSBucketPrefix: natsBucketPrefix,
-			NATSPersist:      natsPersist,
-			RedisAddress:     redisURL,
-			RedisNumDB:       redisNumDB,
+			NATSURL:                     natsURL,
+			NATSTimeout:                 natsTimeout,
+			NATSBucketPrefix:            natsBucketPrefix,
+			NATSOptions:                 natsOptions,
+			NATSBucket:                  natsBucket,
+			NATSDBBuckets:               natsDBBuckets,
+			NATSStartupMode:             natsStartupMode,
+			NATSKeyEncoding:             natsKeyEncoding,
+			RedisAddress:                redisURL,
+			RedisNumDB:                  redisNumDB,
+			RedisPipelineConcurrency:    redisPipelineConcurrency,
+			RedisPipelineMaxConcurrency: redisPipelineMaxConcurrency,
+			RedisPassword:               redisPassword,
+			RedisUsers:                  redisUsers,
+			RedisTLS:                    redisTLS,
 		},
 	)
 
@@ -5,6 +5,7 @@ import (
 	"context"
 	"errors"
 	"log/slog"
+	"math"
 	"slices"
 	"strconv"
 	"strings"
@@ -13,74 +14,191 @@ import (
 	"github.com/henomis/redis2nats/nats"
 )
 
-type redisCommandcmdr func(context.Context, ...string) (string, error)
+type redisCommandcmdr func(*Command, context.Context, ...string) (string, error)
+
+// redisCommandSpec describes a supported command.
+type redisCommandSpec struct {
+	cmdr redisCommandcmdr
+	// arity is the number of arguments, including the command name.
+	// A negative arity means that at least -arity arguments are required.
+	arity int
+	// firstKey, lastKey and keyStep locate the keys among the arguments,
+	// as in the Redis command table. A negative lastKey counts from the end,
+	// a firstKey of 0 means that the command has no keys.
+	firstKey int
+	lastKey  int
+	keyStep  int
+	// categories are the ACL categories of the command, prefixed with @.
+	categories string
+}
+
+// checkArity verifies the number of arguments, including the command name.
+func (s redisCommandSpec) checkArity(commandParts []string) bool {
+	if s.arity < 0 {
+		return len(commandParts) >= -s.arity
+	}
+
+	return len(commandParts) == s.arity
+}
+
+// hasCategory reports whether the command belongs to the ACL category, prefixed with @.
+func (s redisCommandSpec) hasCategory(category string) bool {
+	return slices.Contains(strings.Fields(s.categories), category)
+}
+
+// keys returns the keys among the command parts.
+func (s redisCommandSpec) keys(commandParts []string) []string {
+	if s.firstKey == 0 {
+		return nil
+	}
+
+	lastKey := s.lastKey
+	if lastKey < 0 {
+		lastKey += len(commandParts)
+	}
+
+	var keys []string
+	for i := s.firstKey; i <= lastKey && i < len(commandParts); i += s.keyStep {
+		keys = append(keys, commandParts[i])
+	}
+
+	return keys
+}
+
+// readOnlyCommands are the commands that can be dispatched concurrently when pipelined.
+var readOnlyCommands = map[string]struct{}{
+	"GET":    {},
+	"MGET":   {},
+	"EXISTS": {},
+}
+
+// redisCommands are the supported commands.
+var redisCommands map[string]redisCommandSpec
+
+// nolint:gochecknoinits
+func init() {
+	// The table is built in init as the commands refer to it when dispatching.
+	redisCommands = map[string]redisCommandSpec{
+		"HELLO":       {(*Command).cmdHello, -1, 0, 0, 0, "@fast @connection"},
+		"PING":        {(*Command).cmdPing, -1, 0, 0, 0, "@fast @connection"},
+		"AUTH":        {(*Command).cmdAuth, -2, 0, 0, 0, "@fast @connection"},
+		"SET":         {(*Command).cmdSet, -3, 1, 1, 1, "@write @string @slow"},
+		"SETNX":       {(*Command).cmdSetNX, 3, 1, 1, 1, "@write @string @fast"},
+		"SETEX":       {(*Command).cmdSetEX, 4, 1, 1, 1, "@write @string @slow"},
+		"PSETEX":      {(*Command).cmdPSetEX, 4, 1, 1, 1, "@write @string @slow"},
+		"GETSET":      {(*Command).cmdGetSet, 3, 1, 1, 1, "@write @string @fast"},
+		"GETDEL":      {(*Command).cmdGetDel, 2, 1, 1, 1, "@write @string @fast"},
+		"GETEX":       {(*Command).cmdGetEX, -2, 1, 1, 1, "@write @string @fast"},
+		"GET":         {(*Command).cmdGet, 2, 1, 1, 1, "@read @string @fast"},
+		"MGET":        {(*Command).cmdMGet, -2, 1, -1, 1, "@read @string @fast"},
+		"MSET":        {(*Command).cmdMSet, -3, 1, -1, 2, "@write @string @slow"},
+		"DEL":         {(*Command).cmdDel, -2, 1, -1, 1, "@keyspace @write @slow"},
+		"EXISTS":      {(*Command).cmdExists, -2, 1, -1, 1, "@keyspace @read @fast"},
+		"TYPE":        {(*Command).cmdType, 2, 1, 1, 1, "@keyspace @read @fast"},
+		"KEYS":        {(*Command).cmdKeys, -1, 0, 0, 0, "@keyspace @read @slow @dangerous"},
+		"SELECT":      {(*Command).cmdSelect, 2, 0, 0, 0, "@fast @connection"},
+		"SWAPDB":      {(*Command).cmdSwapDB, 3, 0, 0, 0, "@keyspace @write @fast @dangerous"},
+		"MOVE":        {(*Command).cmdMove, 3, 1, 1, 1, "@keyspace @write @fast"},
+		"FLUSHDB":     {(*Command).cmdFlushDB, -1, 0, 0, 0, "@keyspace @write @slow @dangerous"},
+		"FLUSHALL":    {(*Command).cmdFlushAll, -1, 0, 0, 0, "@keyspace @write @slow @dangerous"},
+		"SCAN":        {(*Command).cmdScan, -2, 0, 0, 0, "@keyspace @read @slow"},
+		"HSCAN":       {(*Command).cmdHScan, -3, 1, 1, 1, "@read @hash @slow"},
+		"DBSIZE":      {(*Command).cmdDBSize, 1, 0, 0, 0, "@keyspace @read @fast"},
+		"RANDOMKEY":   {(*Command).cmdRandomKey, 1, 0, 0, 0, "@keyspace @read @slow"},
+		"INCR":        {(*Command).cmdIncr, 2, 1, 1, 1, "@write @string @fast"},
+		"DECR":        {(*Command).cmdDecr, 2, 1, 1, 1, "@write @string @fast"},
+		"INCRBY":      {(*Command).cmdIncrBy, 3, 1, 1, 1, "@write @string @fast"},
+		"DECRBY":      {(*Command).cmdDecrBy, 3, 1, 1, 1, "@write @string @fast"},
+		"INCRBYFLOAT": {(*Command).cmdIncrByFloat, 3, 1, 1, 1, "@write @string @fast"},
+		"APPEND":      {(*Command).cmdAppend, 3, 1, 1, 1, "@write @string @fast"},
+		"STRLEN":      {(*Command).cmdStrLen, 2, 1, 1, 1, "@read @string @fast"},
+		"GETRANGE":    {(*Command).cmdGetRange, 4, 1, 1, 1, "@read @string @slow"},
+		"SUBSTR":      {(*Command).cmdGetRange, 4, 1, 1, 1, "@read @string @slow"},
+		"SETRANGE":    {(*Command).cmdSetRange, 4, 1, 1, 1, "@write @string @slow"},
+		"LCS":         {(*Command).cmdLCS, -3, 1, 2, 1, "@read @string @slow"},
+		"HSET":        {(*Command).cmdHSet, -4, 1, 1, 1, "@write @hash @fast"},
+		"HGET":        {(*Command).cmdHGet, 3, 1, 1, 1, "@read @hash @fast"},
+		"HDEL":        {(*Command).cmdHDel, -3, 1, 1, 1, "@write @hash @fast"},
+		"HGETALL":     {(*Command).cmdHGetAll, 2, 1, 1, 1, "@read @hash @slow"},
+		"HKEYS":       {(*Command).cmdHKeys, 2, 1, 1, 1, "@read @hash @slow"},
+		"HLEN":        {(*Command).cmdHLen, 2, 1, 1, 1, "@read @hash @fast"},
+		"HEXISTS":     {(*Command).cmdHExists, 3, 1, 1, 1, "@read @hash @fast"},
+		"LPUSH":       {(*Command).cmdLPush, -3, 1, 1, 1, "@write @list @fast"},
+		"LPOP":        {(*Command).cmdLPop, -2, 1, 1, 1, "@write @list @fast"},
+		"LRANGE":      {(*Command).cmdLRange, 4, 1, 1, 1, "@read @list @slow"},
+		"TTL":         {(*Command).cmdTTL, 2, 1, 1, 1, "@keyspace @read @fast"},
+		"EXPIRE":      {(*Command).cmdExpire, -3, 1, 1, 1, "@keyspace @write @fast"},
+		"MULTI":       {(*Command).cmdMulti, 1, 0, 0, 0, "@fast @transaction"},
+		"EXEC":        {(*Command).cmdExec, 1, 0, 0, 0, "@slow @transaction"},
+		"DISCARD":     {(*Command).cmdDiscard, 1, 0, 0, 0, "@fast @transaction"},
+		"WATCH":       {(*Command).cmdWatch, -2, 1, -1, 1, "@fast @transaction"},
+		"UNWATCH":     {(*Command).cmdUnwatch, 1, 0, 0, 0, "@fast @transaction"},
+		"ACL":         {(*Command).cmdACL, -2, 0, 0, 0, "@admin @slow @dangerous"},
+	}
+}
 
 type Command struct {
-	redisCommands map[string]redisCommandcmdr
-	storage       *nats.KV
-	storagePool   []*nats.KV
-	natsTimeout   time.Duration
-	log           *slog.Logger
+	databases   *databases
+	acl         *acl
+	session     *session
+	natsTimeout time.Duration
+	log         *slog.Logger
 }
 
-func NewCommandExecutor(storagePool []*nats.KV, natsTimeout time.Duration) *Command {
-	c := &Command{
-		storage:     storagePool[0],
-		storagePool: storagePool,
+func NewCommandExecutor(databases *databases, acl *acl, natsTimeout time.Duration) *Command {
+	return &Command{
+		databases:   databases,
+		acl:         acl,
+		session:     newSession(acl.initialUser()),
 		natsTimeout: natsTimeout,
 		log:         slog.Default().With("module", "redis-command"),
 	}
+}
 
-	c.redisCommands = map[string]redisCommandcmdr{
-		"PING":    c.cmdPing,
-		"SET":     c.cmdSet,
-		"SETNX":   c.cmdSetNX,
-		"GET":     c.cmdGet,
-		"MGET":    c.cmdMGet,
-		"MSET":    c.cmdMSet,
-		"DEL":     c.cmdDel,
-		"EXISTS":  c.cmdExists,
-		"KEYS":    c.cmdKeys,
-		"SELECT":  c.cmdSelect,
-		"INCR":    c.cmdIncr,
-		"DECR":    c.cmdDecr,
-		"HSET":    c.cmdHSet,
-		"HGET":    c.cmdHGet,
-		"HDEL":    c.cmdHDel,
-		"HGETALL": c.cmdHGetAll,
-		"HKEYS":   c.cmdHKeys,
-		"HLEN":    c.cmdHLen,
-		"HEXISTS": c.cmdHExists,
-		"LPUSH":   c.cmdLPush,
-		"LPOP":    c.cmdLPop,
-		"LRANGE":  c.cmdLRange,
-		"TTL":     c.cmdTTL,
-		"EXPIRE":  c.cmdExpire,
-	}
-
-	return c
-}
-
-func (c *Command) Execute(reader *bufio.Reader) (string, error) {
-	input, err := reader.ReadString(redisLF)
-
+// ReadCommand reads the next command from the reader, either as a RESP array or as an inline command.
+// An empty slice is returned for empty inline commands, which must be ignored.
+func (c *Command) ReadCommand(reader *bufio.Reader) ([]string, error) {
+	input, err := readLine(reader)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	input = strings.TrimSpace(input)
+	// Commands are either RESP Arrays or inline commands
+	if strings.HasPrefix(input, redisArrayPrefix) {
+		return readRESPArray(reader, input, c.session.user != "")
+	}
+
+	return parseInlineCommand(input)
+}
 
-	// Check if it's a RESP Array
-	if !strings.HasPrefix(input, redisArrayPrefix) {
-		return redisNOP, ErrInvalidCommand
+// IsReadOnly reports whether the command only reads data and can be run
+// concurrently with the other read-only commands of a pipeline.
+// Commands are never read-only while a transaction is being queued.
+func (c *Command) IsReadOnly(commandParts []string) bool {
+	if c.session.tx != nil {
+		return false
 	}
 
-	currentStorage := c.storage
+	_, ok := readOnlyCommands[strings.ToUpper(commandParts[0])]
+	return ok
+}
+
+// Execute runs a command read by ReadCommand.
+// Only the keys used by the command are locked, so commands on unrelated keys run in parallel.
+func (c *Command) Execute(commandParts []string) (string, error) {
+	// SWAPDB changes the databases of all the clients, it waits for the running commands
+	if c.swapsDatabases(commandParts) {
+		c.databases.m.Lock()
+		defer c.databases.m.Unlock()
+	} else {
+		c.databases.m.RLock()
+		defer c.databases.m.RUnlock()
+	}
 
-	currentStorage.Lock()
-	defer currentStorage.Unlock()
+	unlock := c.lock(commandParts)
+	defer unlock()
 
-	response, err := c.cmdRESPCommand(reader, input)
+	response, err := c.dispatch(context.Background(), commandParts)
 	if err != nil {
 		return redisNOP, err
 	}
@@ -88,118 +206,216 @@ func (c *Command) Execute(reader *bufio.Reader) (string, error) {
 	return response, nil
 }
 
-// cmdRESPCommand processes RESP commands like SET, GET, PING, etc.
-func (c *Command) cmdRESPCommand(reader *bufio.Reader, input string) (string, error) {
-	// Parse the array length
-	arrayLength, err := strconv.Atoi(input[1:])
-	if err != nil || arrayLength <= 0 {
-		return redisNOP, ErrInvalidCommand
+// swapsDatabases reports whether the command, or the transaction it executes, runs SWAPDB.
+func (c *Command) swapsDatabases(commandParts []string) bool {
+	commandName := strings.ToUpper(commandParts[0])
+
+	if c.session.tx == nil {
+		return commandName == "SWAPDB"
 	}
 
-	// Read each part of the array (command and arguments)
-	var commandParts []string
-	for i := 0; i < arrayLength; i++ {
-		// Read the bulk string header (e.g., $3 for "SET")
-		line, errRead := reader.ReadString(redisLF)
-		if errRead != nil {
-			return redisNOP, ErrInvalidBulkData
-		}
-		line = strings.TrimSpace(line)
+	if commandName != "EXEC" {
+		return false
+	}
 
-		// Make sure it starts with '$'
-		if !strings.HasPrefix(line, redisbulkStringPrefix) {
-			return redisNOP, ErrInvalidBulkData
+	for _, queued := range c.session.tx.queued {
+		if strings.ToUpper(queued[0]) == "SWAPDB" {
+			return true
 		}
+	}
 
-		// Read the bulk string length
-		length, errAtoi := strconv.Atoi(line[1:])
-		if errAtoi != nil || length <= 0 {
-			return redisNOP, ErrInvalidBulkData
-		}
+	return false
+}
 
-		// Read the actual bulk string data
-		bulkString, errRead := reader.ReadString(redisLF)
-		if errRead != nil {
-			return redisNOP, ErrInvalidBulkData
+// lock acquires the locks of the keys used by the command and returns the function releasing them.
+// Read-only commands share the locks of their keys.
+func (c *Command) lock(commandParts []string) func() {
+	if c.session.tx != nil {
+		if strings.ToUpper(commandParts[0]) == "EXEC" {
+			return c.lockTransaction()
 		}
-		bulkString = strings.TrimSpace(bulkString)
-
-		// Append the bulk string to the command parts
-		commandParts = append(commandParts, bulkString)
+		// Commands are only queued until EXEC
+		return func() {}
 	}
 
-	c.log.Debug("Received command", "command", commandParts)
-
-	cmd, ok := c.redisCommands[strings.ToUpper(commandParts[0])]
-	if !ok {
-		return redisNOP, &CommandNotSupportedError{Command: commandParts[0]}
+	if c.IsReadOnly(commandParts) {
+		cmd := redisCommands[strings.ToUpper(commandParts[0])]
+		return c.storage().RLockKeys(cmd.keys(commandParts)...)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), c.natsTimeout)
-	defer cancel()
+	keys := make(map[*nats.KV][]string)
+	c.addCommandKeys(keys, c.session.dbID, commandParts)
 
-	return cmd(ctx, commandParts[1:]...)
+	return lockKeys(keys)
 }
 
-// cmdPing responds with a PONG message.
-func (c *Command) cmdPing(_ context.Context, _ ...string) (string, error) {
-	return redisPong, nil
+// lockTransaction acquires the locks of the keys used by the queued commands.
+// The queued commands may SELECT another database, so the keys are grouped by database.
+func (c *Command) lockTransaction() func() {
+	keys := make(map[*nats.KV][]string)
+
+	dbID := c.session.dbID
+	for _, commandParts := range c.session.tx.queued {
+		if strings.ToUpper(commandParts[0]) == "SELECT" {
+			selectedID, err := c.databases.parseDBID(commandParts[1])
+			if err == nil {
+				dbID = selectedID
+			}
+			continue
+		}
+
+		c.addCommandKeys(keys, dbID, commandParts)
+	}
+
+	return lockKeys(keys)
 }
 
-// cmdSet stores the key-value pair using the provided storage.
-// supported options: XX, EX
-func (c *Command) cmdSet(ctx context.Context, args ...string) (string, error) {
-	if len(args) < 2 {
-		return redisNOP, ErrWrongNumArgs
+// addCommandKeys adds the keys used by the command, run on the database, to the keys to lock.
+func (c *Command) addCommandKeys(keys map[*nats.KV][]string, dbID int, commandParts []string) {
+	commandName := strings.ToUpper(commandParts[0])
+
+	cmd, ok := redisCommands[commandName]
+	if !ok || !cmd.checkArity(commandParts) {
+		return
 	}
 
-	key, value := args[0], args[1]
+	commandKeys := cmd.keys(commandParts)
+	if len(commandKeys) == 0 {
+		return
+	}
 
-	found := true
-	if len(args) > 2 {
-		exists, errExists := c.storage.Exists(ctx, key)
-		if errExists != nil {
-			return redisNOP, ErrCmdFailed
+	storage := c.databases.get(dbID)
+	keys[storage] = append(keys[storage], commandKeys...)
+
+	// MOVE also writes the key in the target database
+	if commandName == "MOVE" {
+		targetID, err := c.databases.parseDBID(commandParts[2])
+		if err == nil {
+			target := c.databases.get(targetID)
+			keys[target] = append(keys[target], commandKeys...)
 		}
-		found = exists == 1
 	}
+}
+
+// dispatch runs the command and arguments parsed from a RESP array or an inline command.
+func (c *Command) dispatch(parent context.Context, commandParts []string) (string, error) {
+	c.log.Debug("Received command", "command", commandParts)
+
+	commandName := strings.ToUpper(commandParts[0])
 
-	// Convert all options to uppercase
-	for i := 2; i < len(args); i++ {
-		args[i] = strings.ToUpper(args[i])
+	cmd, ok := redisCommands[commandName]
+	if !ok {
+		c.abortTransaction()
+		return redisNOP, &CommandNotSupportedError{Command: commandParts[0], Args: commandParts[1:]}
 	}
 
-	// Check if the XX option is set and the key does not exist
-	if slices.Index(args, optionSetXX) != -1 && !found {
-		return redisNil, nil
+	if !cmd.checkArity(commandParts) {
+		c.abortTransaction()
+		return redisNOP, WrongNumArgsError{Command: commandName}
 	}
 
-	err := c.storage.Set(ctx, key, value)
+	err := c.authorize(commandName, cmd, commandParts)
 	if err != nil {
-		return redisNOP, ErrCmdFailed
+		c.abortTransaction()
+		return redisNOP, err
 	}
 
-	// Check if the EX option is set
-	if index := slices.Index(args, optionSetEX); index != -1 {
-		if index+1 >= len(args) {
-			return redisNOP, ErrWrongNumArgs
-		}
+	if c.session.tx != nil && !isTransactionCommand(commandName) {
+		return c.queueCommand(commandParts), nil
+	}
 
-		seconds, errAtoi := strconv.Atoi(args[index+1])
-		if errAtoi != nil {
-			return redisNOP, ErrCmdFailed
-		}
+	// The databases must not be used as mapped before the last SWAPDB
+	err = c.databases.check()
+	if err != nil {
+		return redisNOP, err
+	}
+
+	ctx, cancel := context.WithTimeout(parent, c.natsTimeout)
+	defer cancel()
+
+	// The commands report the wrong number of arguments without knowing their name
+	var wrongNumArgs WrongNumArgsError
+
+	response, err := cmd.cmdr(c, ctx, commandParts[1:]...)
+	if err != nil && errors.Is(err, ErrWrongNumArgs) && !errors.As(err, &wrongNumArgs) {
+		return redisNOP, WrongNumArgsError{Command: commandName}
+	}
 
-		errEpire := c.storage.Expire(ctx, key, time.Duration(seconds)*time.Second)
-		if errEpire != nil {
-			return redisNOP, ErrCmdFailed
+	return response, err
+}
+
+// reply returns the encoder for the protocol version negotiated by the client.
+func (c *Command) reply() replyEncoder {
+	return replyEncoder{protocol: c.session.protocol}
+}
+
+// cmdHello negotiates the protocol version and returns the server properties.
+// syntax: HELLO [protover [AUTH username password] [SETNAME clientname]]
+func (c *Command) cmdHello(_ context.Context, args ...string) (string, error) {
+	protocol := c.session.protocol
+	if len(args) > 0 {
+		version, err := strconv.Atoi(args[0])
+		if err != nil {
+			return redisNOP, ErrProtocolVersion
+		}
+		if version != protocolRESP2 && version != protocolRESP3 {
+			return redisNOP, ErrNoProto
+		}
+		protocol = version
+	}
+
+	clientName := c.session.clientName
+	user := c.session.user
+	for i := 1; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case optionHelloAuth:
+			if i+2 >= len(args) {
+				return redisNOP, ErrSyntax
+			}
+			if !c.acl.authenticate(args[i+1], args[i+2]) {
+				return redisNOP, ErrWrongPass
+			}
+			user = args[i+1]
+			i += 2
+		case optionHelloSetName:
+			if i+1 >= len(args) {
+				return redisNOP, ErrSyntax
+			}
+			clientName = args[i+1]
+			i++
+		default:
+			return redisNOP, ErrSyntax
 		}
 	}
 
-	return redisOK, nil
+	if user == "" {
+		return redisNOP, ErrHelloNoAuth
+	}
+
+	c.session.protocol = protocol
+	c.session.clientName = clientName
+	c.session.user = user
+
+	reply := c.reply()
+
+	return reply.Map(
+		reply.BulkString("server"), reply.BulkString(redisServerName),
+		reply.BulkString("version"), reply.BulkString(redisServerVersion),
+		reply.BulkString("proto"), reply.Integer(int64(c.session.protocol)),
+		reply.BulkString("id"), reply.Integer(c.session.clientID),
+		reply.BulkString("mode"), reply.BulkString("standalone"),
+		reply.BulkString("role"), reply.BulkString("master"),
+		reply.BulkString("modules"), reply.ArrayOfStrings(),
+	), nil
+}
+
+// cmdPing responds with a PONG message.
+func (c *Command) cmdPing(_ context.Context, _ ...string) (string, error) {
+	return redisPong, nil
 }
 
 // cmdSetNX stores the key-value pair using the provided storage only if the key does not exist.
+// It replies 1 if the key was set, 0 otherwise.
 func (c *Command) cmdSetNX(ctx context.Context, args ...string) (string, error) {
 	if len(args) != 2 {
 		return redisNOP, ErrWrongNumArgs
@@ -207,21 +423,16 @@ func (c *Command) cmdSetNX(ctx context.Context, args ...string) (string, error)
 
 	key, value := args[0], args[1]
 
-	exists, errExists := c.storage.Exists(ctx, key)
-	if errExists != nil {
-		return redisNOP, ErrCmdFailed
-	}
-
-	if exists == 1 {
-		return redisNil, nil
+	set, err := c.storage().SetNX(ctx, key, []byte(value))
+	if err != nil {
+		return redisNOP, storageError(err)
 	}
 
-	err := c.storage.Set(ctx, key, value)
-	if err != nil {
-		return redisNOP, ErrCmdFailed
+	if !set {
+		return c.reply().Integer(0), nil
 	}
 
-	return redisOK, nil
+	return c.reply().Integer(1), nil
 }
 
 // cmdMSet stores the key-value pairs using the provided storage.
@@ -230,9 +441,9 @@ func (c *Command) cmdMSet(ctx context.Context, args ...string) (string, error) {
 		return redisNOP, ErrWrongNumArgs
 	}
 
-	err := c.storage.MSet(ctx, args...)
+	err := c.storage().MSet(ctx, args...)
 	if err != nil {
-		return redisNOP, ErrCmdFailed
+		return redisNOP, storageError(err)
 	}
 
 	return redisOK, nil
@@ -245,14 +456,14 @@ func (c *Command) cmdGet(ctx context.Context, args ...string) (string, error) {
 	}
 
 	key := args[0]
-	value, err := c.storage.Get(ctx, key)
+	value, err := c.storage().Get(ctx, key)
 	if err != nil && errors.Is(err, nats.ErrKeyNotFound) {
-		return redisNotFound, nil
+		return c.reply().NullBulk(), nil
 	} else if err != nil {
-		return redisNOP, ErrCmdFailed
+		return redisNOP, storageError(err)
 	}
 
-	return fmtSimpleString(value), nil
+	return c.reply().BulkString(string(value)), nil
 }
 
 // cmdMGet retrieves the values for the given keys using the provided storage.
@@ -261,32 +472,49 @@ func (c *Command) cmdMGet(ctx context.Context, args ...string) (string, error) {
 		return redisNOP, ErrWrongNumArgs
 	}
 
-	values, err := c.storage.MGet(ctx, args...)
+	values, err := c.storage().MGet(ctx, args...)
 	if err != nil {
-		return redisNOP, ErrCmdFailed
+		return redisNOP, storageError(err)
 	}
 
-	return fmtArrayOfString(values...), nil
+	return c.reply().ArrayOfBytes(values...), nil
 }
 
 // cmdDel removes the key-value pair for the given key using the provided storage.
 func (c *Command) cmdDel(ctx context.Context, args ...string) (string, error) {
-	deletedKeys, err := c.storage.Del(ctx, args...)
+	deletedKeys, err := c.storage().Del(ctx, args...)
 	if err != nil {
-		return redisNOP, ErrCmdFailed
+		return redisNOP, storageError(err)
 	}
 
-	return fmtInt(deletedKeys), nil
+	return c.reply().Integer(int64(deletedKeys)), nil
 }
 
 // cmdExists checks if the given key exists in the storage.
 func (c *Command) cmdExists(ctx context.Context, args ...string) (string, error) {
-	exists, err := c.storage.Exists(ctx, args...)
+	exists, err := c.storage().Exists(ctx, args...)
 	if err != nil {
-		return redisNOP, ErrCmdFailed
+		return redisNOP, storageError(err)
+	}
+
+	return c.reply().Integer(int64(exists)), nil
+}
+
+// cmdType returns the type of the value stored at the given key, none if the key does not exist.
+func (c *Command) cmdType(ctx context.Context, args ...string) (string, error) {
+	if len(args) != 1 {
+		return redisNOP, ErrWrongNumArgs
+	}
+
+	key := args[0]
+	keyType, err := c.storage().Type(ctx, key)
+	if err != nil && errors.Is(err, nats.ErrKeyNotFound) {
+		return fmtSimpleString("none"), nil
+	} else if err != nil {
+		return redisNOP, storageError(err)
 	}
 
-	return fmtInt(exists), nil
+	return fmtSimpleString(keyType), nil
 }
 
 // cmdKeys retrieves all keys in the storage.
@@ -296,12 +524,12 @@ func (c *Command) cmdKeys(ctx context.Context, args ...string) (string, error) {
 		pattern = args[0]
 	}
 
-	keys, err := c.storage.Keys(ctx, pattern)
+	keys, err := c.storage().Keys(ctx, pattern)
 	if err != nil {
-		return redisNOP, ErrCmdFailed
+		return redisNOP, storageError(err)
 	}
 
-	return fmtArrayOfString(keys...), nil
+	return c.reply().ArrayOfStrings(keys...), nil
 }
 
 // cmdIncr increments the value for the given key.
@@ -311,12 +539,12 @@ func (c *Command) cmdIncr(ctx context.Context, args ...string) (string, error) {
 	}
 
 	key := args[0]
-	value, err := c.storage.Incr(ctx, key)
+	value, err := c.storage().Incr(ctx, key)
 	if err != nil {
-		return redisNOP, ErrCmdFailed
+		return redisNOP, storageError(err)
 	}
 
-	return fmtInt(value), nil
+	return c.reply().Integer(value), nil
 }
 
 // cmdDecr decrements the value for the given key.
@@ -326,12 +554,72 @@ func (c *Command) cmdDecr(ctx context.Context, args ...string) (string, error) {
 	}
 
 	key := args[0]
-	value, err := c.storage.Decr(ctx, key)
+	value, err := c.storage().Decr(ctx, key)
+	if err != nil {
+		return redisNOP, storageError(err)
+	}
+
+	return c.reply().Integer(value), nil
+}
+
+// cmdIncrBy increments the value for the given key by the given amount.
+func (c *Command) cmdIncrBy(ctx context.Context, args ...string) (string, error) {
+	if len(args) != 2 {
+		return redisNOP, ErrWrongNumArgs
+	}
+
+	key := args[0]
+	increment, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return redisNOP, ErrNotInteger
+	}
+
+	value, err := c.storage().IncrBy(ctx, key, increment)
+	if err != nil {
+		return redisNOP, storageError(err)
+	}
+
+	return c.reply().Integer(value), nil
+}
+
+// cmdDecrBy decrements the value for the given key by the given amount.
+func (c *Command) cmdDecrBy(ctx context.Context, args ...string) (string, error) {
+	if len(args) != 2 {
+		return redisNOP, ErrWrongNumArgs
+	}
+
+	key := args[0]
+	decrement, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return redisNOP, ErrNotInteger
+	}
+
+	if decrement == math.MinInt64 {
+		return redisNOP, ErrDecrementOverflow
+	}
+
+	value, err := c.storage().IncrBy(ctx, key, -decrement)
+	if err != nil {
+		return redisNOP, storageError(err)
+	}
+
+	return c.reply().Integer(value), nil
+}
+
+// cmdIncrByFloat increments the floating point value for the given key by the given amount.
+func (c *Command) cmdIncrByFloat(ctx context.Context, args ...string) (string, error) {
+	if len(args) != 2 {
+		return redisNOP, ErrWrongNumArgs
+	}
+
+	key, increment := args[0], args[1]
+
+	value, err := c.storage().IncrByFloat(ctx, key, increment)
 	if err != nil {
-		return redisNOP, ErrCmdFailed
+		return redisNOP, storageError(err)
 	}
 
-	return fmtInt(value), nil
+	return c.reply().BulkString(value), nil
 }
 
 // cmdHSet stores the key-value pair in a hash using the provided storage.
@@ -343,12 +631,12 @@ func (c *Command) cmdHSet(ctx context.Context, args ...string) (string, error) {
 	key := args[0]
 	fieldsValues := args[1:]
 
-	added, err := c.storage.HSet(ctx, key, fieldsValues...)
+	added, err := c.storage().HSet(ctx, key, fieldsValues...)
 	if err != nil {
-		return redisNOP, ErrCmdFailed
+		return redisNOP, storageError(err)
 	}
 
-	return fmtInt(added), nil
+	return c.reply().Integer(int64(added)), nil
 }
 
 // cmdHGet retrieves the value for the given field in a hash using the provided storage.
@@ -358,18 +646,16 @@ func (c *Command) cmdHGet(ctx context.Context, args ...string) (string, error) {
 	}
 
 	key, field := args[0], args[1]
-	value, err := c.storage.HGet(ctx, key, field)
+	value, err := c.storage().HGet(ctx, key, field)
 	if err != nil && errors.Is(err, nats.ErrKeyNotFound) {
-		// return redisNotFound, ErrCmdFailed
-		return redisNotFound, ErrCmdFailed
+		return c.reply().NullBulk(), nil
 	} else if err != nil && errors.Is(err, nats.ErrFieldNotFound) {
-		// return redisNotFound, ErrCmdFailed
-		return redisNotFound, ErrCmdFailed
+		return c.reply().NullBulk(), nil
 	} else if err != nil {
-		return redisNOP, ErrCmdFailed
+		return redisNOP, storageError(err)
 	}
 
-	return fmtBulkString(value), nil
+	return c.reply().BulkString(value), nil
 }
 
 // cmdHDel removes the field from a hash using the provided storage.
@@ -381,14 +667,14 @@ func (c *Command) cmdHDel(ctx context.Context, args ...string) (string, error) {
 	key := args[0]
 	fields := args[1:]
 
-	deleted, err := c.storage.HDel(ctx, key, fields...)
+	deleted, err := c.storage().HDel(ctx, key, fields...)
 	if err != nil && errors.Is(err, nats.ErrKeyNotFound) {
 		deleted = 0
 	} else if err != nil {
-		return redisNOP, ErrCmdFailed
+		return redisNOP, storageError(err)
 	}
 
-	return fmtInt(deleted), nil
+	return c.reply().Integer(int64(deleted)), nil
 }
 
 // cmdHGetAll retrieves all fields and values from a hash using the provided storage.
@@ -399,18 +685,18 @@ func (c *Command) cmdHGetAll(ctx context.Context, args ...string) (string, error
 
 	fieldsValues := []string{}
 	key := args[0]
-	hash, err := c.storage.HGetAll(ctx, key)
+	hash, err := c.storage().HGetAll(ctx, key)
 	if err != nil && errors.Is(err, nats.ErrKeyNotFound) {
 		fieldsValues = []string{}
 	} else if err != nil {
-		return redisNOP, ErrCmdFailed
+		return redisNOP, storageError(err)
 	}
 
 	for field, value := range hash {
 		fieldsValues = append(fieldsValues, field, value)
 	}
 
-	return fmtArrayOfString(fieldsValues...), nil
+	return c.reply().MapOfStrings(fieldsValues...), nil
 }
 
 // cmdHKeys retrieves all fields from a hash using the provided storage.
@@ -420,14 +706,14 @@ func (c *Command) cmdHKeys(ctx context.Context, args ...string) (string, error)
 	}
 
 	key := args[0]
-	fields, err := c.storage.HKeys(ctx, key)
+	fields, err := c.storage().HKeys(ctx, key)
 	if err != nil && errors.Is(err, nats.ErrKeyNotFound) {
 		fields = []string{}
 	} else if err != nil {
-		fields = []string{}
+		return redisNOP, storageError(err)
 	}
 
-	return fmtArrayOfString(fields...), nil
+	return c.reply().ArrayOfStrings(fields...), nil
 }
 
 // cmdHLen retrieves the number of fields in a hash using the provided storage.
@@ -437,14 +723,14 @@ func (c *Command) cmdHLen(ctx context.Context, args ...string) (string, error) {
 	}
 
 	key := args[0]
-	length, err := c.storage.HLen(ctx, key)
+	length, err := c.storage().HLen(ctx, key)
 	if err != nil && errors.Is(err, nats.ErrKeyNotFound) {
 		length = 0
 	} else if err != nil {
-		return redisNOP, ErrCmdFailed
+		return redisNOP, storageError(err)
 	}
 
-	return fmtInt(length), nil
+	return c.reply().Integer(int64(length)), nil
 }
 
 // cmdHExists checks if the field exists in a hash using the provided storage.
@@ -454,20 +740,20 @@ func (c *Command) cmdHExists(ctx context.Context, args ...string) (string, error
 	}
 
 	key, field := args[0], args[1]
-	exists, err := c.storage.HExists(ctx, key, field)
+	exists, err := c.storage().HExists(ctx, key, field)
 	if err != nil && errors.Is(err, nats.ErrKeyNotFound) {
 		exists = false
 	} else if err != nil && errors.Is(err, nats.ErrFieldNotFound) {
 		exists = false
 	} else if err != nil {
-		return redisNOP, ErrCmdFailed
+		return redisNOP, storageError(err)
 	}
 
 	if !exists {
-		return fmtInt(0), nil
+		return c.reply().Integer(0), nil
 	}
 
-	return fmtInt(1), nil
+	return c.reply().Integer(1), nil
 }
 
 // cmdLPush prepends the value to the list stored at the key using the provided storage.
@@ -479,12 +765,12 @@ func (c *Command) cmdLPush(ctx context.Context, args ...string) (string, error)
 	key := args[0]
 	values := args[1:]
 
-	length, err := c.storage.LPush(ctx, key, values...)
+	length, err := c.storage().LPush(ctx, key, values...)
 	if err != nil {
-		return redisNOP, ErrCmdFailed
+		return redisNOP, storageError(err)
 	}
 
-	return fmtInt(length), nil
+	return c.reply().Integer(int64(length)), nil
 }
 
 // cmdLPop removes and returns the first element of the list stored at the key using the provided storage.
@@ -498,23 +784,29 @@ func (c *Command) cmdLPop(ctx context.Context, args ...string) (string, error) {
 	count := 1
 	if len(args) == 2 {
 		count, err = strconv.Atoi(args[1])
-		if err != nil {
-			return redisNOP, ErrCmdFailed
+		if err != nil || count < 0 {
+			return redisNOP, ErrNotPositive
 		}
 	}
 
-	values, err := c.storage.LPop(ctx, key, count)
-	if err != nil && errors.Is(err, nats.ErrKeyNotFound) {
-		return redisNotFound, nil
-	} else if err != nil {
-		return redisNOP, ErrCmdFailed
+	values, err := c.storage().LPop(ctx, key, count)
+	if err != nil && !errors.Is(err, nats.ErrKeyNotFound) {
+		return redisNOP, storageError(err)
+	}
+
+	// A missing key and an empty list are both replied with a null
+	if err != nil || (len(values) == 0 && count > 0) {
+		if len(args) == 1 {
+			return c.reply().NullBulk(), nil
+		}
+		return c.reply().NullArray(), nil
 	}
 
 	if len(args) == 1 {
-		return fmtBulkString(values[0]), nil
+		return c.reply().BulkString(values[0]), nil
 	}
 
-	return fmtArrayOfString(values...), nil
+	return c.reply().ArrayOfStrings(values...), nil
 }
 
 // cmdLRange retrieves the elements of the list stored at the key using the provided storage.
@@ -526,22 +818,22 @@ func (c *Command) cmdLRange(ctx context.Context, args ...string) (string, error)
 	key := args[0]
 	start, err := strconv.Atoi(args[1])
 	if err != nil {
-		return redisNOP, ErrCmdFailed
+		return redisNOP, ErrNotInteger
 	}
 
 	stop, err := strconv.Atoi(args[2])
 	if err != nil {
-		return redisNOP, ErrCmdFailed
+		return redisNOP, ErrNotInteger
 	}
 
-	values, err := c.storage.LRange(ctx, key, start, stop)
+	values, err := c.storage().LRange(ctx, key, start, stop)
 	if err != nil && errors.Is(err, nats.ErrKeyNotFound) {
 		values = []string{}
 	} else if err != nil {
-		return redisNOP, ErrCmdFailed
+		return redisNOP, storageError(err)
 	}
 
-	return fmtArrayOfString(values...), nil
+	return c.reply().ArrayOfStrings(values...), nil
 }
 
 func (c *Command) cmdTTL(ctx context.Context, args ...string) (string, error) {
@@ -550,16 +842,16 @@ func (c *Command) cmdTTL(ctx context.Context, args ...string) (string, error) {
 	}
 
 	key := args[0]
-	ttl, err := c.storage.TTL(ctx, key)
+	ttl, err := c.storage().TTL(ctx, key)
 	if err != nil && errors.Is(err, nats.ErrKeyNotFound) {
-		return fmtInt(-2), nil
+		return c.reply().Integer(-2), nil
 	} else if err != nil && errors.Is(err, nats.ErrExpKeyNotFound) {
-		return fmtInt(-1), nil
+		return c.reply().Integer(-1), nil
 	} else if err != nil {
-		return redisNOP, ErrCmdFailed
+		return redisNOP, storageError(err)
 	}
 
-	return fmtInt64(ttl), nil
+	return c.reply().Integer(ttl), nil
 }
 
 func (c *Command) cmdExpire(ctx context.Context, args ...string) (string, error) {
@@ -570,33 +862,15 @@ func (c *Command) cmdExpire(ctx context.Context, args ...string) (string, error)
 	key := args[0]
 	seconds, err := strconv.Atoi(args[1])
 	if err != nil {
-		return redisNOP, ErrCmdFailed
+		return redisNOP, ErrNotInteger
 	}
 
-	err = c.storage.Expire(ctx, key, time.Duration(seconds)*time.Second)
+	err = c.storage().Expire(ctx, key, time.Duration(seconds)*time.Second)
 	if err != nil && errors.Is(err, nats.ErrKeyNotFound) {
-		return fmtInt(0), nil
+		return c.reply().Integer(0), nil
 	} else if err != nil {
-		return redisNOP, ErrCmdFailed
-	}
-
-	return fmtInt(1), nil
-}
-
-// cmdSelect switches the active database to the given ID.
-func (c *Command) cmdSelect(_ context.Context, args ...string) (string, error) {
-	if len(args) != 1 {
-		return redisNOP, ErrWrongNumArgs
+		return redisNOP, storageError(err)
 	}
 
-	dbID := args[0]
-
-	dbIDAsInt, err := strconv.Atoi(dbID)
-	if err != nil || dbIDAsInt < 0 || dbIDAsInt >= len(c.storagePool) {
-		return redisNOP, ErrInvalidDB
-	}
-
-	c.storage = c.storagePool[dbIDAsInt]
-
-	return redisOK, nil
+	return c.reply().Integer(1), nil
 }
@@ -2,68 +2,188 @@ package redisnats
 
 import (
 	"bufio"
+	"crypto/tls"
+	"errors"
+	"io"
 	"log/slog"
 	"net"
 	"time"
-
-	"github.com/henomis/redis2nats/nats"
 )
 
 type Connection struct {
-	conn        net.Conn
-	storagePool []*nats.KV
-	natsTimeout time.Duration
-	log         *slog.Logger
+	conn                net.Conn
+	databases           *databases
+	acl                 *acl
+	tls                 *TLSConfig
+	natsTimeout         time.Duration
+	pipelineConcurrency bool
+	// pipelineSlots limits the pipelined read-only commands running at once.
+	pipelineSlots chan struct{}
+	log           *slog.Logger
+}
+
+// pendingReply is the reply of a pipelined command that may still be running.
+type pendingReply struct {
+	done     chan struct{}
+	response string
+	err      error
 }
 
-func NewConnection(conn net.Conn, storagePool []*nats.KV, natsTimeout time.Duration) *Connection {
+func NewConnection(conn net.Conn, databases *databases, acl *acl, tlsConfig *TLSConfig, natsTimeout time.Duration, pipelineConcurrency bool, pipelineMaxConcurrency int) *Connection {
 	return &Connection{
-		conn:        conn,
-		storagePool: storagePool,
-		natsTimeout: natsTimeout,
-		log:         slog.Default().With("module", "redis-connection"),
+		conn:                conn,
+		databases:           databases,
+		acl:                 acl,
+		tls:                 tlsConfig,
+		natsTimeout:         natsTimeout,
+		pipelineConcurrency: pipelineConcurrency,
+		pipelineSlots:       make(chan struct{}, pipelineMaxConcurrency),
+		log:                 slog.Default().With("module", "redis-connection"),
 	}
 }
 
 // handle processes each incoming connection.
+// Replies are buffered and flushed only when all the pipelined commands
+// received so far have been processed.
 func (c *Connection) handle() {
 	defer c.conn.Close()
 
 	c.log.Info("New connection", "address", c.conn.RemoteAddr())
 
-	commandExecutor := NewCommandExecutor(c.storagePool, c.natsTimeout)
+	commandExecutor := NewCommandExecutor(c.databases, c.acl, c.natsTimeout)
+
+	if tlsConn, ok := c.conn.(*tls.Conn); ok {
+		err := tlsConn.Handshake()
+		if err != nil {
+			c.log.Error("TLS handshake failed", "address", c.conn.RemoteAddr(), "error", err)
+			return
+		}
+
+		// Clients presenting a certificate may be authenticated as the ACL user named after it
+		if user := c.tls.certificateUser(tlsConn.ConnectionState()); user != "" {
+			commandExecutor.authenticateAs(user)
+		}
+	}
 
 	reader := bufio.NewReader(c.conn)
+	writer := bufio.NewWriter(c.conn)
+
+	var pending []*pendingReply
 	for {
-		response, err := commandExecutor.Execute(reader)
-		if err != nil && err.Error() == "EOF" {
+		commandParts, err := commandExecutor.ReadCommand(reader)
+		if err != nil && errors.Is(err, io.EOF) {
 			c.log.Info("Connection closed", "address", c.conn.RemoteAddr())
+			_ = c.writePending(writer, pending)
+			_ = writer.Flush()
 			return
 		} else if err != nil {
-			c.log.Error("Error processing command", "error", err)
-			errWrite := c.writeError(c.conn, err)
+			// The request could not be read: reply with the error and close the connection
+			c.log.Error("Error reading command", "address", c.conn.RemoteAddr(), "error", err)
+
+			var protocolError ProtocolError
+			if !errors.As(err, &protocolError) {
+				protocolError = ProtocolError{Message: err.Error()}
+			}
+
+			pending = append(pending, resolvedReply(redisNOP, protocolError))
+			_ = c.writePending(writer, pending)
+			_ = writer.Flush()
+			return
+		}
+
+		switch {
+		case len(commandParts) == 0:
+			// Empty inline commands are silently ignored
+		case c.pipelineConcurrency && commandExecutor.IsReadOnly(commandParts):
+			pending = append(pending, c.executeAsync(commandExecutor, commandParts))
+		default:
+			// Commands with side effects run only after the previous ones completed
+			errWrite := c.writePending(writer, pending)
 			if errWrite != nil {
-				c.log.Error("Error writing error message", "error", errWrite)
 				return
 			}
-		} else {
-			errWrite := c.writeResponse(c.conn, response)
+			pending = pending[:0]
+
+			response, errExecute := commandExecutor.Execute(commandParts)
+			pending = append(pending, resolvedReply(response, errExecute))
+		}
+
+		if reader.Buffered() > 0 {
+			continue
+		}
+
+		errWrite := c.writePending(writer, pending)
+		if errWrite != nil {
+			return
+		}
+		pending = pending[:0]
+
+		errWrite = writer.Flush()
+		if errWrite != nil {
+			c.log.Error("Error writing response", "error", errWrite)
+			return
+		}
+	}
+}
+
+// executeAsync runs a read-only command in the background.
+// It waits for a free slot when the maximum number of commands is already running,
+// which also stops reading the pipeline.
+func (c *Connection) executeAsync(commandExecutor *Command, commandParts []string) *pendingReply {
+	reply := &pendingReply{done: make(chan struct{})}
+
+	c.pipelineSlots <- struct{}{}
+
+	go func() {
+		defer func() { <-c.pipelineSlots }()
+		defer close(reply.done)
+		reply.response, reply.err = commandExecutor.Execute(commandParts)
+	}()
+
+	return reply
+}
+
+// resolvedReply returns a pendingReply for a command that already completed.
+func resolvedReply(response string, err error) *pendingReply {
+	reply := &pendingReply{done: make(chan struct{}), response: response, err: err}
+	close(reply.done)
+
+	return reply
+}
+
+// writePending waits for the pending replies and writes them in order.
+func (c *Connection) writePending(writer *bufio.Writer, pending []*pendingReply) error {
+	for _, reply := range pending {
+		<-reply.done
+
+		if reply.err != nil {
+			c.log.Error("Error processing command", "error", reply.err)
+			errWrite := c.writeError(writer, reply.err)
 			if errWrite != nil {
-				c.log.Error("Error writing response", "error", errWrite)
-				return
+				c.log.Error("Error writing error message", "error", errWrite)
+				return errWrite
 			}
+			continue
+		}
+
+		errWrite := c.writeResponse(writer, reply.response)
+		if errWrite != nil {
+			c.log.Error("Error writing response", "error", errWrite)
+			return errWrite
 		}
 	}
+
+	return nil
 }
 
 // writeResponse writes a simple Redis RESP message.
-func (c *Connection) writeResponse(conn net.Conn, message string) error {
-	_, err := conn.Write([]byte(message))
+func (c *Connection) writeResponse(writer io.Writer, message string) error {
+	_, err := io.WriteString(writer, message)
 	return err
 }
 
 // writeError writes an error message to the client.
-func (c *Connection) writeError(conn net.Conn, cmdErr error) error {
-	_, err := conn.Write([]byte(fmtSimpleError(cmdErr.Error())))
+func (c *Connection) writeError(writer io.Writer, cmdErr error) error {
+	_, err := io.WriteString(writer, fmtError(cmdErr))
 	return err
 }
@@ -0,0 +1,377 @@
+package redisnats
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/henomis/redis2nats/nats"
+)
+
+// databases maps the database IDs to their storage.
+// The mapping is shared by all the clients of the instances using the same buckets
+// and changed by SWAPDB, commands hold a read lock on it while they run.
+type databases struct {
+	m sync.RWMutex
+	// buckets are the storages by bucket index, storages by database ID.
+	buckets  []*nats.KV
+	storages []*nats.KV
+	mapping  *nats.Mapping
+	// revision is the revision of the mapping applied last.
+	revision uint64
+	// swaps counts the changes of the mapping so far.
+	swaps uint64
+	// err is the error opening the buckets of the last mapping, which is not applied yet.
+	err error
+}
+
+func newDatabases(ctx context.Context, buckets []*nats.KV, mapping *nats.Mapping) (*databases, error) {
+	d := &databases{
+		buckets:  buckets,
+		storages: slices.Clone(buckets),
+		mapping:  mapping,
+	}
+
+	current, revision, err := mapping.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.apply(ctx, current, revision)
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// apply maps the databases to the buckets of the mapping, opening the buckets
+// of the databases that changed. Mappings older than the applied one are ignored.
+// If the buckets cannot be opened the storages are left unchanged and the error is
+// kept, failing the commands until a mapping is applied. The caller holds the write lock.
+func (d *databases) apply(ctx context.Context, mapping []int, revision uint64) error {
+	if revision < d.revision {
+		return nil
+	}
+
+	changed := make(map[int]*nats.KV)
+	for dbID, bucket := range mapping {
+		if d.storages[dbID] != d.buckets[bucket] {
+			changed[dbID] = d.buckets[bucket]
+		}
+	}
+
+	if len(changed) == 0 {
+		d.revision = revision
+		d.err = nil
+		return nil
+	}
+
+	// Clients may have selected any of the changed databases.
+	for _, storage := range changed {
+		err := storage.Open(ctx)
+		if err != nil {
+			d.err = err
+			return err
+		}
+	}
+
+	for dbID, storage := range changed {
+		d.storages[dbID] = storage
+	}
+	d.revision = revision
+	d.swaps++
+	d.err = nil
+
+	return nil
+}
+
+// watch applies the mappings stored by the other instances.
+func (d *databases) watch(ctx context.Context) error {
+	return d.mapping.Watch(ctx, func(mapping []int, revision uint64) error {
+		d.m.Lock()
+		defer d.m.Unlock()
+
+		return d.apply(ctx, mapping, revision)
+	})
+}
+
+// check returns the error opening the buckets of a mapping that is not applied yet.
+// The caller holds the lock.
+func (d *databases) check() error {
+	if d.err != nil {
+		return ErrDatabaseMapping
+	}
+
+	return nil
+}
+
+// get returns the storage of the database.
+func (d *databases) get(dbID int) *nats.KV {
+	return d.storages[dbID]
+}
+
+// open creates the buckets of the database, if not already done.
+func (d *databases) open(ctx context.Context, dbID int) error {
+	return d.storages[dbID].Open(ctx)
+}
+
+// count returns the number of databases.
+func (d *databases) count() int {
+	return len(d.storages)
+}
+
+// parseDBID parses a database ID, checking that the database exists.
+func (d *databases) parseDBID(dbID string) (int, error) {
+	dbIDAsInt, err := strconv.Atoi(dbID)
+	if err != nil {
+		return 0, ErrNotInteger
+	}
+
+	if dbIDAsInt < 0 || dbIDAsInt >= d.count() {
+		return 0, ErrInvalidDB
+	}
+
+	return dbIDAsInt, nil
+}
+
+// lockKeys acquires the locks of the keys of each storage and returns the function releasing them.
+// Storages are locked in bucket order, which does not depend on the mapping, to avoid deadlocks.
+func lockKeys(keys map[*nats.KV][]string) func() {
+	storages := make([]*nats.KV, 0, len(keys))
+	for storage := range keys {
+		storages = append(storages, storage)
+	}
+
+	slices.SortFunc(storages, func(a, b *nats.KV) int {
+		return strings.Compare(a.Bucket(), b.Bucket())
+	})
+
+	unlocks := make([]func(), 0, len(storages))
+	for _, storage := range storages {
+		unlocks = append(unlocks, storage.LockKeys(keys[storage]...))
+	}
+
+	return func() {
+		for i := len(unlocks) - 1; i >= 0; i-- {
+			unlocks[i]()
+		}
+	}
+}
+
+// storage returns the storage of the database selected by the client.
+func (c *Command) storage() *nats.KV {
+	return c.databases.get(c.session.dbID)
+}
+
+// cmdSelect switches the active database to the given ID.
+func (c *Command) cmdSelect(ctx context.Context, args ...string) (string, error) {
+	if len(args) != 1 {
+		return redisNOP, ErrWrongNumArgs
+	}
+
+	dbID, err := c.databases.parseDBID(args[0])
+	if err != nil {
+		return redisNOP, err
+	}
+
+	err = c.databases.open(ctx, dbID)
+	if err != nil {
+		return redisNOP, storageError(err)
+	}
+
+	c.session.dbID = dbID
+
+	return redisOK, nil
+}
+
+// cmdSwapDB swaps two databases, for all the clients of the instances using the same buckets.
+// The caller holds the write lock of the databases mapping.
+func (c *Command) cmdSwapDB(ctx context.Context, args ...string) (string, error) {
+	if len(args) != 2 {
+		return redisNOP, ErrWrongNumArgs
+	}
+
+	if _, err := strconv.Atoi(args[0]); err != nil {
+		return redisNOP, ErrInvalidFirstDB
+	}
+
+	if _, err := strconv.Atoi(args[1]); err != nil {
+		return redisNOP, ErrInvalidSecondDB
+	}
+
+	first, err := c.databases.parseDBID(args[0])
+	if err != nil {
+		return redisNOP, err
+	}
+
+	second, err := c.databases.parseDBID(args[1])
+	if err != nil {
+		return redisNOP, err
+	}
+
+	mapping, revision, err := c.databases.mapping.Swap(ctx, first, second)
+	if err != nil {
+		return redisNOP, storageError(err)
+	}
+
+	err = c.databases.apply(ctx, mapping, revision)
+	if err != nil {
+		return redisNOP, storageError(err)
+	}
+
+	return redisOK, nil
+}
+
+// cmdMove moves a key from the selected database to the given one.
+func (c *Command) cmdMove(ctx context.Context, args ...string) (string, error) {
+	if len(args) != 2 {
+		return redisNOP, ErrWrongNumArgs
+	}
+
+	key := args[0]
+
+	dbID, err := c.databases.parseDBID(args[1])
+	if err != nil {
+		return redisNOP, err
+	}
+
+	if dbID == c.session.dbID {
+		return redisNOP, ErrSameDB
+	}
+
+	err = c.databases.open(ctx, dbID)
+	if err != nil {
+		return redisNOP, storageError(err)
+	}
+
+	moved, err := c.storage().Move(ctx, key, c.databases.get(dbID))
+	if err != nil && errors.Is(err, nats.ErrKeyNotFound) {
+		return c.reply().Integer(0), nil
+	} else if err != nil {
+		return redisNOP, storageError(err)
+	}
+
+	if !moved {
+		return c.reply().Integer(0), nil
+	}
+
+	return c.reply().Integer(1), nil
+}
+
+// parseFlushMode parses the optional ASYNC or SYNC argument of FLUSHDB and FLUSHALL.
+func parseFlushMode(args []string) (bool, error) {
+	if len(args) == 0 {
+		return false, nil
+	}
+
+	if len(args) > 1 {
+		return false, ErrSyntax
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "ASYNC":
+		return true, nil
+	case "SYNC":
+		return false, nil
+	default:
+		return false, ErrSyntax
+	}
+}
+
+// flush removes all the keys of the storages. When async, the keys are removed
+// in the background and the function returns immediately.
+func (c *Command) flush(ctx context.Context, async bool, storages ...*nats.KV) error {
+	if async {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), c.natsTimeout)
+			defer cancel()
+
+			for _, storage := range storages {
+				err := storage.Flush(ctx)
+				if err != nil {
+					c.log.Error("Error flushing database", "bucket", storage.Bucket(), "error", err)
+				}
+			}
+		}()
+
+		return nil
+	}
+
+	for _, storage := range storages {
+		err := storage.Flush(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cmdFlushDB removes all the keys of the selected database.
+func (c *Command) cmdFlushDB(ctx context.Context, args ...string) (string, error) {
+	async, err := parseFlushMode(args)
+	if err != nil {
+		return redisNOP, err
+	}
+
+	err = c.flush(ctx, async, c.storage())
+	if err != nil {
+		return redisNOP, storageError(err)
+	}
+
+	return redisOK, nil
+}
+
+// cmdFlushAll removes all the keys of all the databases.
+func (c *Command) cmdFlushAll(ctx context.Context, args ...string) (string, error) {
+	async, err := parseFlushMode(args)
+	if err != nil {
+		return redisNOP, err
+	}
+
+	storages := make([]*nats.KV, 0, c.databases.count())
+	for dbID := 0; dbID < c.databases.count(); dbID++ {
+		storages = append(storages, c.databases.get(dbID))
+	}
+
+	err = c.flush(ctx, async, storages...)
+	if err != nil {
+		return redisNOP, storageError(err)
+	}
+
+	return redisOK, nil
+}
+
+// cmdDBSize returns the number of keys in the selected database.
+func (c *Command) cmdDBSize(ctx context.Context, args ...string) (string, error) {
+	if len(args) != 0 {
+		return redisNOP, ErrWrongNumArgs
+	}
+
+	size, err := c.storage().DBSize(ctx)
+	if err != nil {
+		return redisNOP, storageError(err)
+	}
+
+	return c.reply().Integer(int64(size)), nil
+}
+
+// cmdRandomKey returns a random key of the selected database.
+func (c *Command) cmdRandomKey(ctx context.Context, args ...string) (string, error) {
+	if len(args) != 0 {
+		return redisNOP, ErrWrongNumArgs
+	}
+
+	key, err := c.storage().RandomKey(ctx)
+	if err != nil && errors.Is(err, nats.ErrKeyNotFound) {
+		return c.reply().NullBulk(), nil
+	} else if err != nil {
+		return redisNOP, storageError(err)
+	}
+
+	return c.reply().BulkString(key), nil
+}
@@ -1,19 +1,175 @@
 package redisnats
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/henomis/redis2nats/nats"
 )
 
-var ErrInvalidCommand = errors.New("invalid command")
-var ErrInvalidDB = errors.New("invalid database ID")
+var ErrInvalidCommand = ProtocolError{Message: "invalid multibulk length"}
+var ErrInvalidDB = errors.New("DB index is out of range")
+var ErrInvalidFirstDB = errors.New("invalid first DB index")
+var ErrInvalidSecondDB = errors.New("invalid second DB index")
+var ErrDatabaseMapping = errors.New("the databases swapped by SWAPDB could not be opened")
+var ErrSameDB = errors.New("source and destination objects are the same")
 var ErrWrongNumArgs = errors.New("wrong number of arguments")
-var ErrCmdFailed = errors.New("failed to set value")
-var ErrInvalidBulkData = errors.New("invalid bulk data")
+var ErrCmdFailed = errors.New("storage operation failed")
+var ErrTimeout = errors.New("timeout waiting for the storage")
+var ErrInvalidBulkData = ProtocolError{Message: "invalid bulk length"}
+var ErrLineTooLong = ProtocolError{Message: "too big inline request"}
+var ErrUnauthenticatedBulkLength = ProtocolError{Message: "unauthenticated bulk length"}
+var ErrUnauthenticatedArrayLength = ProtocolError{Message: "unauthenticated multibulk length"}
+var ErrUnbalancedQuotes = ProtocolError{Message: "unbalanced quotes in request"}
+var ErrSyntax = errors.New("syntax error")
+var ErrProtocolVersion = errors.New("Protocol version is not an integer or out of range")
+var ErrNoProto = PrefixedError{Prefix: "NOPROTO", Message: "unsupported protocol version"}
+var ErrMultiNested = errors.New("MULTI calls can not be nested")
+var ErrExecWithoutMulti = errors.New("EXEC without MULTI")
+var ErrDiscardWithoutMulti = errors.New("DISCARD without MULTI")
+var ErrExecAbort = PrefixedError{Prefix: "EXECABORT", Message: "Transaction discarded because of previous errors."}
+var ErrNoAuth = PrefixedError{Prefix: "NOAUTH", Message: "Authentication required."}
+var ErrHelloNoAuth = PrefixedError{Prefix: "NOAUTH", Message: "HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time"}
+var ErrWrongPass = PrefixedError{Prefix: "WRONGPASS", Message: "invalid username-password pair or user is disabled."}
+var ErrAuthNoPassword = errors.New("AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+var ErrNoPermissionKey = PrefixedError{Prefix: "NOPERM", Message: "No permissions to access a key"}
+var ErrACLUserDefinition = errors.New("invalid ACL user definition")
+var ErrUnknownCategory = errors.New("Unknown category")
+var ErrACLDeleteDefaultUser = errors.New("The 'default' user cannot be removed")
+var ErrTLSVersion = errors.New("unsupported TLS version")
+var ErrTLSAuthClients = errors.New("invalid TLS client authentication mode")
+var ErrTLSAuthClientsUser = errors.New("invalid TLS client certificate user field")
+var ErrTLSCA = errors.New("no certificate found in CA file")
+var ErrTLSCipherSuite = errors.New("unsupported TLS cipher suite")
+var ErrNotInteger = errors.New("value is not an integer or out of range")
+var ErrNotFloat = errors.New("value is not a valid float")
+var ErrOverflow = errors.New("increment or decrement would overflow")
+var ErrDecrementOverflow = errors.New("decrement would overflow")
+var ErrNaNOrInfinity = errors.New("increment would produce NaN or Infinity")
+var ErrOffsetOutOfRange = errors.New("offset is out of range")
+var ErrStringTooLong = errors.New("string exceeds maximum allowed size (proto-max-bulk-len)")
+var ErrLCSWrongType = errors.New("The specified keys must contain string values")
+var ErrLCSLenAndIdx = errors.New("If you want both the length and indexes, please just use IDX.")
+var ErrLCSTooLarge = errors.New("Insufficient memory, transient memory for LCS exceeds proto-max-bulk-len")
+var ErrNotPositive = errors.New("value is out of range, must be positive")
+var ErrInvalidCursor = errors.New("invalid cursor")
+var ErrWrongType = PrefixedError{Prefix: "WRONGTYPE", Message: "Operation against a key holding the wrong kind of value"}
+var ErrInvalidPayload = errors.New("the value stored at the key is not a valid hash or list")
+var ErrWatchInsideMulti = errors.New("WATCH inside MULTI is not allowed")
+
+// storageError maps an error of the storage to the Redis error replied to the client.
+func storageError(err error) error {
+	switch {
+	case errors.Is(err, nats.ErrWrongType):
+		return ErrWrongType
+	case errors.Is(err, nats.ErrNotInteger):
+		return ErrNotInteger
+	case errors.Is(err, nats.ErrNotFloat):
+		return ErrNotFloat
+	case errors.Is(err, nats.ErrOverflow):
+		return ErrOverflow
+	case errors.Is(err, nats.ErrNaNOrInfinity):
+		return ErrNaNOrInfinity
+	case errors.Is(err, nats.ErrStringTooLong):
+		return ErrStringTooLong
+	case errors.Is(err, nats.ErrLCSTooLarge):
+		return ErrLCSTooLarge
+	case errors.Is(err, nats.ErrInvalidPayload):
+		return ErrInvalidPayload
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrTimeout
+	default:
+		return ErrCmdFailed
+	}
+}
 
+// CommandNotSupportedError is returned for the commands that are not in the command table.
 type CommandNotSupportedError struct {
 	Command string
+	Args    []string
 }
 
 func (e CommandNotSupportedError) Error() string {
-	return "command not supported: " + e.Command
+	var args strings.Builder
+	for _, arg := range e.Args {
+		fmt.Fprintf(&args, "'%s' ", arg)
+	}
+
+	return fmt.Sprintf("unknown command '%s', with args beginning with: %s", e.Command, args.String())
+}
+
+// WrongNumArgsError is returned when the command is called with the wrong number of arguments.
+// It matches ErrWrongNumArgs, which the commands return without knowing their name.
+type WrongNumArgsError struct {
+	Command string
+}
+
+func (e WrongNumArgsError) Error() string {
+	return fmt.Sprintf("wrong number of arguments for '%s' command", strings.ToLower(e.Command))
+}
+
+func (e WrongNumArgsError) Is(target error) bool {
+	return target == ErrWrongNumArgs
+}
+
+// invalidExpireTimeError is returned when the expire time of the command is not valid.
+func invalidExpireTimeError(command string) error {
+	return fmt.Errorf("invalid expire time in '%s' command", strings.ToLower(command))
+}
+
+// PrefixedError is an error replied with a Redis error prefix other than the generic ERR.
+type PrefixedError struct {
+	Prefix  string
+	Message string
+}
+
+func (e PrefixedError) Error() string {
+	return e.Prefix + " " + e.Message
+}
+
+// ProtocolError is returned when a request cannot be parsed. As the bytes following
+// it cannot be trusted, the connection is closed after replying with the error.
+type ProtocolError struct {
+	Message string
+}
+
+func (e ProtocolError) Error() string {
+	return "Protocol error: " + e.Message
+}
+
+// expectedBulkError is returned when an element of a RESP array is not a bulk string.
+func expectedBulkError(header string) error {
+	got := ""
+	if header != "" {
+		got = header[:1]
+	}
+
+	return ProtocolError{Message: fmt.Sprintf("expected '$', got '%s'", got)}
+}
+
+// noPermissionError is returned when the user is not allowed to run the command.
+func noPermissionError(user, command string) error {
+	return PrefixedError{Prefix: "NOPERM", Message: fmt.Sprintf("User %s has no permissions to run the '%s' command", user, command)}
+}
+
+// ACLRuleError is returned when an ACL SETUSER rule is invalid.
+type ACLRuleError struct {
+	Rule    string
+	Message string
+}
+
+func (e ACLRuleError) Error() string {
+	return fmt.Sprintf("Error in ACL SETUSER modifier '%s': %s", e.Rule, e.Message)
+}
+
+// UnknownSubcommandError is returned when the subcommand of a container command is not supported.
+type UnknownSubcommandError struct {
+	Command    string
+	Subcommand string
+}
+
+func (e UnknownSubcommandError) Error() string {
+	return fmt.Sprintf("unknown subcommand '%s'. Try %s HELP.", e.Subcommand, e.Command)
 }
@@ -0,0 +1,347 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const (
+	BucketStorageFile   = "file"
+	BucketStorageMemory = "memory"
+
+	// kvStreamPrefix is the prefix of the streams backing the key-value buckets.
+	kvStreamPrefix = "KV_"
+	// keyEncodingMetadata is the metadata of the stream of a bucket recording the encoding of its keys.
+	keyEncodingMetadata = "redis2nats_key_encoding"
+)
+
+// BucketPlacement restricts the servers a bucket is placed on.
+type BucketPlacement struct {
+	Cluster string
+	Tags    []string
+}
+
+// BucketConfig represents the configuration of the key-value buckets of a database.
+// Zero values use the JetStream defaults.
+type BucketConfig struct {
+	// Replicas is the number of replicas of the bucket.
+	Replicas int
+	// Storage is the storage backend: file (the default) or memory.
+	Storage string
+	// MaxBytes is the maximum size of the bucket.
+	MaxBytes int64
+	// MaxValueSize is the maximum size of a value.
+	MaxValueSize int32
+	// History is the number of revisions kept for each key.
+	History uint8
+	// Compression enables the S2 compression of the bucket.
+	Compression bool
+	// Placement restricts the servers the bucket is placed on.
+	Placement BucketPlacement
+	// Description is the description of the bucket.
+	Description string
+	// Reconcile updates existing buckets whose configuration differs,
+	// instead of only logging a warning.
+	Reconcile bool
+}
+
+// keyValueConfig returns the JetStream configuration of the bucket.
+func (c *BucketConfig) keyValueConfig(bucket string) (jetstream.KeyValueConfig, error) {
+	storage, err := c.storageType()
+	if err != nil {
+		return jetstream.KeyValueConfig{}, err
+	}
+
+	config := jetstream.KeyValueConfig{
+		Bucket:       bucket,
+		Description:  c.Description,
+		MaxValueSize: c.MaxValueSize,
+		History:      c.History,
+		MaxBytes:     c.MaxBytes,
+		Storage:      storage,
+		Replicas:     c.Replicas,
+		Compression:  c.Compression,
+	}
+
+	if c.Placement.Cluster != "" || len(c.Placement.Tags) > 0 {
+		config.Placement = &jetstream.Placement{
+			Cluster: c.Placement.Cluster,
+			Tags:    c.Placement.Tags,
+		}
+	}
+
+	return config, nil
+}
+
+// expirationConfig returns the configuration of the expiration bucket:
+// it is stored like the data bucket, without the limits on the values.
+func (c *BucketConfig) expirationConfig() BucketConfig {
+	return BucketConfig{
+		Replicas:    c.Replicas,
+		Storage:     c.Storage,
+		Compression: c.Compression,
+		Placement:   c.Placement,
+		Reconcile:   c.Reconcile,
+	}
+}
+
+func (c *BucketConfig) storageType() (jetstream.StorageType, error) {
+	switch c.Storage {
+	case BucketStorageFile, "":
+		return jetstream.FileStorage, nil
+	case BucketStorageMemory:
+		return jetstream.MemoryStorage, nil
+	default:
+		return 0, fmt.Errorf("%w: %s", ErrInvalidBucketStorage, c.Storage)
+	}
+}
+
+// bucketDifferences lists the settings of an existing bucket that differ from the configuration.
+func bucketDifferences(config jetstream.KeyValueConfig, stream jetstream.StreamConfig) []string {
+	var differences []string
+
+	differ := func(setting string, want, got any) {
+		differences = append(differences, fmt.Sprintf("%s: want %v, got %v", setting, want, got))
+	}
+
+	if replicas := max(config.Replicas, 1); replicas != stream.Replicas {
+		differ("replicas", replicas, stream.Replicas)
+	}
+
+	if config.Storage != stream.Storage {
+		differ("storage", config.Storage, stream.Storage)
+	}
+
+	if maxBytes := limit(config.MaxBytes); maxBytes != stream.MaxBytes {
+		differ("maxBytes", maxBytes, stream.MaxBytes)
+	}
+
+	if maxValueSize := limit(config.MaxValueSize); maxValueSize != stream.MaxMsgSize {
+		differ("maxValueSize", maxValueSize, stream.MaxMsgSize)
+	}
+
+	if history := int64(max(config.History, 1)); history != stream.MaxMsgsPerSubject {
+		differ("history", history, stream.MaxMsgsPerSubject)
+	}
+
+	if compression := stream.Compression == jetstream.S2Compression; config.Compression != compression {
+		differ("compression", config.Compression, compression)
+	}
+
+	var cluster, streamCluster string
+	var tags, streamTags []string
+	if config.Placement != nil {
+		cluster, tags = config.Placement.Cluster, config.Placement.Tags
+	}
+	if stream.Placement != nil {
+		streamCluster, streamTags = stream.Placement.Cluster, stream.Placement.Tags
+	}
+
+	if cluster != streamCluster || !slices.Equal(tags, streamTags) {
+		differ("placement", fmt.Sprintf("%s%v", cluster, tags), fmt.Sprintf("%s%v", streamCluster, streamTags))
+	}
+
+	if config.Description != stream.Description {
+		differ("description", config.Description, stream.Description)
+	}
+
+	return differences
+}
+
+// limit converts a zero limit to the JetStream unlimited value.
+func limit[T int32 | int64](value T) T {
+	if value == 0 {
+		return -1
+	}
+
+	return value
+}
+
+// createBucket creates a bucket with the configuration.
+// When the bucket already exists, its configuration is reconciled, unless already
+// done at startup.
+func (n *KV) createBucket(ctx context.Context, bucket string, c BucketConfig) (jetstream.KeyValue, error) {
+	config, err := c.keyValueConfig(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := n.jetstream.CreateKeyValue(ctx, config)
+	if err == nil {
+		return store, nil
+	} else if !errors.Is(err, jetstream.ErrBucketExists) {
+		return nil, err
+	}
+
+	if n.reconciled[bucket] {
+		return n.jetstream.KeyValue(ctx, bucket)
+	}
+
+	return n.reconcileBucket(ctx, bucket, c, config)
+}
+
+// reconcileBucket checks the configuration of an existing bucket. When it differs, the
+// bucket is updated if the configuration asks to reconcile it, otherwise the differences are logged.
+func (n *KV) reconcileBucket(ctx context.Context, bucket string, c BucketConfig, config jetstream.KeyValueConfig) (jetstream.KeyValue, error) {
+	stream, err := n.jetstream.Stream(ctx, kvStreamPrefix+bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	differences := bucketDifferences(config, stream.CachedInfo().Config)
+	if len(differences) == 0 {
+		return n.jetstream.KeyValue(ctx, bucket)
+	}
+
+	if !c.Reconcile {
+		n.log.Warn("Existing bucket configuration differs", "bucket", bucket, "differences", differences)
+		return n.jetstream.KeyValue(ctx, bucket)
+	}
+
+	store, err := n.jetstream.UpdateKeyValue(ctx, config)
+	if err != nil {
+		n.log.Warn("Error reconciling bucket configuration", "bucket", bucket, "differences", differences, "error", err)
+		return n.jetstream.KeyValue(ctx, bucket)
+	}
+
+	// The key-value configuration has no metadata: the recorded key encoding is written back
+	if encoding, ok := stream.CachedInfo().Config.Metadata[keyEncodingMetadata]; ok {
+		err = n.setMetadata(ctx, bucket, map[string]string{keyEncodingMetadata: encoding})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	n.log.Info("Reconciled bucket configuration", "bucket", bucket, "differences", differences)
+
+	return store, nil
+}
+
+// bucketEncoding returns the encoding of the keys of the bucket, recorded in the metadata
+// of its stream. Empty buckets without it record the configured encoding, while the
+// buckets filled by earlier versions, which stored the keys as they are, keep doing so.
+func (n *KV) bucketEncoding(ctx context.Context, stream jetstream.Stream) (KeyEncoding, error) {
+	info := stream.CachedInfo()
+
+	if recorded, ok := info.Config.Metadata[keyEncodingMetadata]; ok {
+		encoding := KeyEncoding(recorded)
+		if encoding != n.encoding {
+			n.log.Warn("Bucket keeps the key encoding it was created with", "bucket", n.bucket, "keyEncoding", encoding, "configured", n.encoding)
+		}
+
+		return encoding, encoding.validate()
+	}
+
+	if info.State.Msgs > 0 {
+		n.log.Warn("Bucket created by an earlier version, its keys are stored as they are", "bucket", n.bucket)
+		return KeyEncodingNone, nil
+	}
+
+	err := n.setMetadata(ctx, n.bucket, map[string]string{keyEncodingMetadata: string(n.encoding)})
+	if err != nil {
+		return "", err
+	}
+
+	return n.encoding, nil
+}
+
+// setMetadata adds the entries to the metadata of the stream of the bucket, if missing.
+func (n *KV) setMetadata(ctx context.Context, bucket string, metadata map[string]string) error {
+	stream, err := n.jetstream.Stream(ctx, kvStreamPrefix+bucket)
+	if err != nil {
+		return err
+	}
+
+	config := stream.CachedInfo().Config
+
+	missing := false
+	for key, value := range metadata {
+		if config.Metadata[key] != value {
+			missing = true
+		}
+	}
+
+	if !missing {
+		return nil
+	}
+
+	if config.Metadata == nil {
+		config.Metadata = make(map[string]string)
+	}
+
+	for key, value := range metadata {
+		config.Metadata[key] = value
+	}
+
+	_, err = n.jetstream.UpdateStream(ctx, config)
+
+	return err
+}
+
+// Reconcile checks the configuration of the existing buckets of the key-value stores
+// at startup. Missing buckets are not created: they are created, and checked, on first use.
+func (m *Manager) Reconcile(ctx context.Context, kvs []*KV) error {
+	for _, kv := range kvs {
+		err := kv.reconcile(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reconcile checks the configuration of the existing buckets of the key-value store.
+func (n *KV) reconcile(ctx context.Context) error {
+	n.openLock.Lock()
+	defer n.openLock.Unlock()
+
+	buckets := []struct {
+		name   string
+		config BucketConfig
+	}{
+		{n.bucket, n.config},
+		{n.expirationBucket, n.config.expirationConfig()},
+	}
+
+	for _, bucket := range buckets {
+		config, err := bucket.config.keyValueConfig(bucket.name)
+		if err != nil {
+			return err
+		}
+
+		_, err = n.reconcileBucket(ctx, bucket.name, bucket.config, config)
+		if err != nil && errors.Is(err, jetstream.ErrStreamNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		n.reconciled[bucket.name] = true
+	}
+
+	return nil
+}
+
+// Flush removes all the keys, and their expiration, from the key-value store.
+func (n *KV) Flush(ctx context.Context) error {
+	for _, bucket := range []string{n.bucket, n.expirationBucket} {
+		stream, err := n.jetstream.Stream(ctx, kvStreamPrefix+bucket)
+		if err != nil && errors.Is(err, jetstream.ErrStreamNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		err = stream.Purge(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,156 @@
+package nats
+
+import (
+	"context"
+	"errors"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// modifyFunc computes the new data of a key from its current data.
+// found is false if the key does not exist.
+// It returns errRemoveKey to remove the key, with its expiration, instead.
+type modifyFunc func(value []byte, found bool) ([]byte, error)
+
+// errRemoveKey is returned by a modifyFunc to remove the key, as Redis does
+// with the hashes and the lists left empty.
+var errRemoveKey = errors.New("remove key")
+
+// write creates the key if the revision is 0, otherwise it updates the key
+// only if its latest revision is still the given one.
+func (n *KV) write(ctx context.Context, key string, value []byte, revision uint64) (uint64, error) {
+	if revision == 0 {
+		return n.store.Create(ctx, key, value)
+	}
+
+	return n.store.Update(ctx, key, value, revision)
+}
+
+// put writes the value.
+func (n *KV) put(ctx context.Context, key string, value []byte) error {
+	_, err := n.store.Put(ctx, key, value)
+	return err
+}
+
+// purge removes the key.
+func (n *KV) purge(ctx context.Context, key string) error {
+	err := n.store.Purge(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	n.compact(ctx, key)
+
+	return nil
+}
+
+// update performs a read-modify-write of the data of the key, which must hold a value
+// of the given type, otherwise ErrWrongType is returned.
+func (n *KV) update(ctx context.Context, key, keyType string, modify modifyFunc) error {
+	return n.updateValue(ctx, key, func(value []byte, found bool) ([]byte, error) {
+		var data []byte
+		if found {
+			var valueType string
+			valueType, data = decodeValue(value, keyType)
+			if valueType != keyType {
+				return nil, ErrWrongType
+			}
+		}
+
+		data, err := modify(data, found)
+		if err != nil {
+			return nil, err
+		}
+
+		return encodeValue(keyType, data), nil
+	})
+}
+
+// updateValue performs a read-modify-write of the stored value of the key as a
+// compare-and-set on its revision. If the key is modified concurrently, by this or by another instance, the value
+// is read again and the write retried, so no update is lost.
+// If modify returns errRemoveKey, the key and its expiration are removed at the revision that was read.
+func (n *KV) updateValue(ctx context.Context, key string, modify modifyFunc) error {
+	for {
+		var value []byte
+		var revision uint64
+
+		entry, err := n.store.Get(ctx, key)
+		if err != nil && !errors.Is(err, jetstream.ErrKeyNotFound) {
+			return err
+		}
+
+		found := err == nil
+		if found {
+			value, revision = entry.Value(), entry.Revision()
+		}
+
+		data, err := modify(value, found)
+		if err != nil && errors.Is(err, errRemoveKey) {
+			if !found {
+				return nil
+			}
+
+			err = n.removeRevision(ctx, key, revision)
+			if err != nil && errors.Is(err, ErrKeyExists) {
+				n.log.Debug("Key modified concurrently, retrying", "key", key)
+				continue
+			}
+
+			return err
+		} else if err != nil {
+			return err
+		}
+
+		_, err = n.write(ctx, key, data, revision)
+		if err != nil && errors.Is(err, jetstream.ErrKeyExists) {
+			n.log.Debug("Key modified concurrently, retrying", "key", key)
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		return nil
+	}
+}
+
+// create writes the key only if it does not exist and returns its revision.
+// It returns ErrKeyExists if the key exists.
+func (n *KV) create(ctx context.Context, key string, value []byte) (uint64, error) {
+	revision, err := n.store.Create(ctx, key, value)
+	if err != nil && errors.Is(err, jetstream.ErrKeyExists) {
+		return 0, ErrKeyExists
+	} else if err != nil {
+		return 0, err
+	}
+
+	return revision, nil
+}
+
+// removeRevision removes the key, and its expiration, only if its latest revision is
+// still the given one. It returns ErrKeyExists if the key was modified since.
+func (n *KV) removeRevision(ctx context.Context, key string, revision uint64) error {
+	err := n.purgeRevision(ctx, key, revision)
+	if err != nil {
+		return err
+	}
+
+	_, err = n.clearExpiration(ctx, key)
+
+	return err
+}
+
+// purgeRevision removes the key only if its latest revision is still the given one,
+// which must not be 0. It returns ErrKeyExists if the key was modified since.
+func (n *KV) purgeRevision(ctx context.Context, key string, revision uint64) error {
+	err := n.store.Purge(ctx, key, jetstream.LastRevision(revision))
+	if err != nil && errors.Is(err, jetstream.ErrKeyExists) {
+		return ErrKeyExists
+	} else if err != nil {
+		return err
+	}
+
+	n.compact(ctx, key)
+
+	return nil
+}
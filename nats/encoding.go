@@ -0,0 +1,329 @@
+package nats
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// KeyEncoding is the scheme used to store Redis keys, which may contain any byte,
+// as NATS KV keys, which are restricted to a subject-safe alphabet.
+type KeyEncoding string
+
+const (
+	// KeyEncodingNone stores the keys as they are: keys that are not valid NATS KV keys are rejected.
+	KeyEncodingNone KeyEncoding = "none"
+	// KeyEncodingEscape stores the valid keys as they are and escapes the unsafe bytes
+	// of the other keys as =XX, keeping the dots that separate non-empty tokens.
+	// Colons separate tokens too: they are escaped and followed by a dot.
+	KeyEncodingEscape KeyEncoding = "escape"
+	// KeyEncodingBase64 stores all the keys encoded in URL-safe base64.
+	KeyEncodingBase64 KeyEncoding = "base64"
+
+	// escapeChar starts an escaped byte in the escape encoding.
+	escapeChar = '='
+	// encodedEmptyKey is the encoding of the empty key, which is not a valid NATS KV key.
+	encodedEmptyKey = "=="
+
+	// allKeysFilter is the subject filter matching all the keys.
+	allKeysFilter = jetstream.AllKeys
+
+	// globSpecialChars are the characters with a special meaning in a glob-style pattern.
+	globSpecialChars = `*?[\`
+)
+
+// validFilterRe matches the literal keys that can be used in a subject filter.
+var validFilterRe = regexp.MustCompile(`^[-/_=a-zA-Z0-9]+(\.[-/_=a-zA-Z0-9]+)*$`)
+
+// validate checks that the key encoding is supported.
+func (e KeyEncoding) validate() error {
+	switch e {
+	case KeyEncodingNone, KeyEncodingEscape, KeyEncodingBase64:
+		return nil
+	default:
+		return fmt.Errorf("%w: %s", ErrInvalidKeyEncoding, e)
+	}
+}
+
+// encode converts a Redis key to a NATS KV key.
+func (e KeyEncoding) encode(key string) string {
+	switch e {
+	case KeyEncodingEscape:
+		return escapeKey(key)
+	case KeyEncodingBase64:
+		if key == "" {
+			return encodedEmptyKey
+		}
+		return base64.RawURLEncoding.EncodeToString([]byte(key))
+	default:
+		return key
+	}
+}
+
+// decode converts a NATS KV key back to a Redis key.
+// Keys that were not produced by the encoding are returned as they are.
+func (e KeyEncoding) decode(key string) string {
+	switch e {
+	case KeyEncodingEscape:
+		decoded, ok := unescapeKey(key)
+		if !ok {
+			return key
+		}
+		return decoded
+	case KeyEncodingBase64:
+		if key == encodedEmptyKey {
+			return ""
+		}
+		decoded, err := base64.RawURLEncoding.DecodeString(key)
+		if err != nil {
+			return key
+		}
+		return string(decoded)
+	default:
+		return key
+	}
+}
+
+// subjectFilters translates a glob-style pattern into the narrowest subject filters
+// matching all the encoded keys the pattern matches. NATS subject filters only match
+// whole tokens, so the filter is the literal prefix of the pattern up to its last
+// token separator, followed by the > wildcard; the pattern must still be matched
+// on the keys. Patterns without special characters are exact keys.
+// The escape encoding stores the key made of the prefix and a trailing separator
+// with the separator escaped, out of the > wildcard, so it is matched by a second filter.
+func (e KeyEncoding) subjectFilters(pattern string) []string {
+	literalEnd := strings.IndexAny(pattern, globSpecialChars)
+	if literalEnd < 0 {
+		encoded := e.encode(pattern)
+		if e == KeyEncodingNone && !validFilterRe.MatchString(encoded) {
+			return []string{allKeysFilter}
+		}
+
+		return []string{encoded}
+	}
+
+	// Base64 does not preserve the prefixes of the keys
+	if e == KeyEncodingBase64 {
+		return []string{allKeysFilter}
+	}
+
+	separators := "."
+	if e == KeyEncodingEscape {
+		separators = ".:"
+	}
+
+	tokensEnd := strings.LastIndexAny(pattern[:literalEnd], separators)
+	if tokensEnd <= 0 {
+		return []string{allKeysFilter}
+	}
+
+	// The encoding of the prefix is the one it has in the keys going on after it
+	prefix := pattern[:tokensEnd+1]
+	encoded := strings.TrimSuffix(e.encode(prefix+"x"), "x")
+	if !strings.HasSuffix(encoded, ".") || !validFilterRe.MatchString(strings.TrimSuffix(encoded, ".")) {
+		return []string{allKeysFilter}
+	}
+
+	filters := []string{encoded + allKeysFilter}
+	if e == KeyEncodingEscape {
+		filters = append(filters, e.encode(prefix))
+	}
+
+	return filters
+}
+
+// isSafeKeyByte reports whether the byte can appear unescaped in an encoded key.
+func isSafeKeyByte(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' ||
+		b == '-' || b == '_' || b == '/'
+}
+
+// escapeKey escapes the bytes of the key that are not valid in a NATS KV key,
+// the escape character itself and the dots that would make an empty token.
+// Colons are followed by a dot, so that they separate tokens.
+func escapeKey(key string) string {
+	if key == "" {
+		return encodedEmptyKey
+	}
+
+	var encoded strings.Builder
+	for i := 0; i < len(key); i++ {
+		b := key[i]
+		last := i == len(key)-1
+
+		switch {
+		case isSafeKeyByte(b):
+			encoded.WriteByte(b)
+		case b == '.' && i > 0 && !last && key[i-1] != '.' && key[i-1] != ':':
+			encoded.WriteByte(b)
+		case b == ':' && !last:
+			fmt.Fprintf(&encoded, "%c%02X.", escapeChar, b)
+		default:
+			fmt.Fprintf(&encoded, "%c%02X", escapeChar, b)
+		}
+	}
+
+	return encoded.String()
+}
+
+// unescapeKey reverts escapeKey. It reports false if the key is not a valid escaped key.
+func unescapeKey(key string) (string, bool) {
+	if key == encodedEmptyKey {
+		return "", true
+	}
+
+	if strings.IndexByte(key, escapeChar) < 0 {
+		return key, true
+	}
+
+	var decoded strings.Builder
+	for i := 0; i < len(key); i++ {
+		if key[i] != escapeChar {
+			decoded.WriteByte(key[i])
+			continue
+		}
+
+		if i+2 >= len(key) {
+			return "", false
+		}
+
+		b, err := strconv.ParseUint(key[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", false
+		}
+
+		decoded.WriteByte(byte(b))
+		i += 2
+
+		// The dot following a colon is its token separator
+		if b == ':' && i+1 < len(key) && key[i+1] == '.' {
+			i++
+		}
+	}
+
+	return decoded.String(), true
+}
+
+// encodedKeyValue is a key-value store whose keys are transparently encoded.
+// Subject filters passed to Watch must already be encoded.
+type encodedKeyValue struct {
+	jetstream.KeyValue
+	encoding KeyEncoding
+}
+
+func (kv encodedKeyValue) Get(ctx context.Context, key string) (jetstream.KeyValueEntry, error) {
+	entry, err := kv.KeyValue.Get(ctx, kv.encoding.encode(key))
+	if err != nil {
+		return nil, err
+	}
+
+	return encodedEntry{KeyValueEntry: entry, encoding: kv.encoding}, nil
+}
+
+func (kv encodedKeyValue) Put(ctx context.Context, key string, value []byte) (uint64, error) {
+	return kv.KeyValue.Put(ctx, kv.encoding.encode(key), value)
+}
+
+func (kv encodedKeyValue) Create(ctx context.Context, key string, value []byte) (uint64, error) {
+	return kv.KeyValue.Create(ctx, kv.encoding.encode(key), value)
+}
+
+func (kv encodedKeyValue) Update(ctx context.Context, key string, value []byte, revision uint64) (uint64, error) {
+	return kv.KeyValue.Update(ctx, kv.encoding.encode(key), value, revision)
+}
+
+func (kv encodedKeyValue) Delete(ctx context.Context, key string, opts ...jetstream.KVDeleteOpt) error {
+	return kv.KeyValue.Delete(ctx, kv.encoding.encode(key), opts...)
+}
+
+func (kv encodedKeyValue) Purge(ctx context.Context, key string, opts ...jetstream.KVDeleteOpt) error {
+	return kv.KeyValue.Purge(ctx, kv.encoding.encode(key), opts...)
+}
+
+func (kv encodedKeyValue) Watch(ctx context.Context, keys string, opts ...jetstream.WatchOpt) (jetstream.KeyWatcher, error) {
+	watcher, err := kv.KeyValue.Watch(ctx, keys, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return newEncodedKeyWatcher(watcher, kv.encoding), nil
+}
+
+func (kv encodedKeyValue) WatchAll(ctx context.Context, opts ...jetstream.WatchOpt) (jetstream.KeyWatcher, error) {
+	watcher, err := kv.KeyValue.WatchAll(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return newEncodedKeyWatcher(watcher, kv.encoding), nil
+}
+
+// encodedEntry is an entry whose key is decoded.
+type encodedEntry struct {
+	jetstream.KeyValueEntry
+	encoding KeyEncoding
+}
+
+func (e encodedEntry) Key() string {
+	return e.encoding.decode(e.KeyValueEntry.Key())
+}
+
+// encodedKeyWatcher is a watcher whose entries have their keys decoded.
+type encodedKeyWatcher struct {
+	watcher jetstream.KeyWatcher
+	updates chan jetstream.KeyValueEntry
+	stop    chan struct{}
+}
+
+func newEncodedKeyWatcher(watcher jetstream.KeyWatcher, encoding KeyEncoding) *encodedKeyWatcher {
+	w := &encodedKeyWatcher{
+		watcher: watcher,
+		updates: make(chan jetstream.KeyValueEntry, 256),
+		stop:    make(chan struct{}),
+	}
+
+	go func() {
+		defer close(w.updates)
+
+		for {
+			var entry jetstream.KeyValueEntry
+			var ok bool
+
+			select {
+			case <-w.stop:
+				return
+			case entry, ok = <-watcher.Updates():
+				if !ok {
+					return
+				}
+			}
+
+			// The nil entry marks the end of the initial values
+			if entry != nil {
+				entry = encodedEntry{KeyValueEntry: entry, encoding: encoding}
+			}
+
+			select {
+			case <-w.stop:
+				return
+			case w.updates <- entry:
+			}
+		}
+	}()
+
+	return w
+}
+
+func (w *encodedKeyWatcher) Updates() <-chan jetstream.KeyValueEntry {
+	return w.updates
+}
+
+func (w *encodedKeyWatcher) Stop() error {
+	close(w.stop)
+	return w.watcher.Stop()
+}
@@ -5,6 +5,21 @@ import "errors"
 var ErrGeneral = errors.New("general error")
 var ErrKeyNotFound = errors.New("key not found")
 var ErrExpKeyNotFound = errors.New("expiration key not found")
+var ErrWrongType = errors.New("wrong type")
+var ErrNotInteger = errors.New("value is not an integer")
+var ErrNotFloat = errors.New("value is not a float")
+var ErrOverflow = errors.New("increment or decrement would overflow")
+var ErrNaNOrInfinity = errors.New("increment would produce NaN or Infinity")
+var ErrStringTooLong = errors.New("string exceeds maximum allowed size")
+var ErrLCSTooLarge = errors.New("memory for LCS exceeds the maximum string size")
 var ErrFieldNotFound = errors.New("field not found")
 var ErrOptionNotFound = errors.New("option not found")
 var ErrOptionNotSupported = errors.New("option not supported")
+var ErrKeyExists = errors.New("key exists")
+var ErrInvalidBucketStorage = errors.New("invalid bucket storage")
+var ErrBucketExists = errors.New("bucket already exists")
+var ErrInvalidKeyEncoding = errors.New("invalid key encoding")
+var ErrInvalidStartupMode = errors.New("invalid startup mode")
+var ErrInstancesRunning = errors.New("refusing to delete the buckets used by running instances")
+var ErrInvalidMapping = errors.New("invalid database mapping")
+var ErrInvalidPayload = errors.New("invalid hash or list payload")
@@ -0,0 +1,126 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// secondsExpirationLimit bounds the expirations stored by earlier versions, in Unix seconds:
+// expirations are now stored in Unix milliseconds, which are all above it.
+const secondsExpirationLimit = 1e11
+
+// parseExpiration parses an expiration time stored in the expiration bucket.
+func parseExpiration(value []byte) (time.Time, error) {
+	expiration, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if expiration < secondsExpirationLimit {
+		return time.Unix(expiration, 0), nil
+	}
+
+	return time.UnixMilli(expiration), nil
+}
+
+// setExpiration stores the expiration time of the key.
+func (n *KV) setExpiration(ctx context.Context, key string, at time.Time) error {
+	n.log.Info("Setting expiration", "key", key, "expiration", at.UnixMilli())
+
+	_, err := n.expirationStore.Put(ctx, key, []byte(strconv.FormatInt(at.UnixMilli(), 10)))
+	return err
+}
+
+// setExpirationValue stores the expiration of the key as stored in another expiration bucket.
+func (n *KV) setExpirationValue(ctx context.Context, key string, value []byte) error {
+	_, err := n.expirationStore.Put(ctx, key, value)
+	return err
+}
+
+// clearExpiration removes the expiration time of the key, if any.
+// It reports whether the key had an expiration.
+func (n *KV) clearExpiration(ctx context.Context, key string) (bool, error) {
+	_, err := n.expirationStore.Get(ctx, key)
+	if err != nil && errors.Is(err, jetstream.ErrKeyNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	err = n.expirationStore.Purge(ctx, key)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// ExpireAt sets the expiration time of an existing key.
+// A time in the past removes the key.
+func (n *KV) ExpireAt(ctx context.Context, key string, at time.Time) error {
+	_, err := n.Type(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	if !at.After(time.Now()) {
+		_, err = n.Del(ctx, key)
+		return err
+	}
+
+	return n.setExpiration(ctx, key, at)
+}
+
+// Persist removes the expiration time of an existing key.
+// It reports whether the key had an expiration.
+func (n *KV) Persist(ctx context.Context, key string) (bool, error) {
+	_, err := n.Type(ctx, key)
+	if err != nil {
+		return false, err
+	}
+
+	return n.clearExpiration(ctx, key)
+}
+
+// expireKey removes an expired key and its expiration, read at the given revision.
+// Both are only removed at the revisions that were read: the key is kept if another
+// instance wrote it, or changed its expiration, in the meantime.
+func (n *KV) expireKey(ctx context.Context, key string, expirationRevision uint64) error {
+	entry, err := n.store.Get(ctx, key)
+	if err != nil && !errors.Is(err, jetstream.ErrKeyNotFound) {
+		return err
+	}
+
+	if err == nil {
+		expiration, errGet := n.expirationStore.Get(ctx, key)
+		if errGet != nil && errors.Is(errGet, jetstream.ErrKeyNotFound) {
+			return nil
+		} else if errGet != nil {
+			return errGet
+		}
+
+		if expiration.Revision() != expirationRevision {
+			return nil
+		}
+
+		err = n.purgeRevision(ctx, key, entry.Revision())
+		if err != nil && errors.Is(err, ErrKeyExists) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		n.log.Info("Key expired", "key", key)
+	}
+
+	err = n.expirationStore.Purge(ctx, key, jetstream.LastRevision(expirationRevision))
+	if err != nil && !errors.Is(err, jetstream.ErrKeyExists) {
+		return err
+	}
+
+	return nil
+}
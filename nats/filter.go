@@ -0,0 +1,49 @@
+package nats
+
+import (
+	"context"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// ListKeysFiltered returns the keys matching any of the subject filters, which may
+// use the NATS wildcards. Only the matching keys are sent by the server.
+func (n *KV) ListKeysFiltered(ctx context.Context, filters ...string) ([]string, error) {
+	keys := make([]string, 0)
+
+	for _, filter := range filters {
+		filtered, err := n.listKeysFiltered(ctx, filter)
+		if err != nil {
+			return keys, err
+		}
+
+		keys = append(keys, filtered...)
+	}
+
+	return keys, nil
+}
+
+// listKeysFiltered returns the keys matching the subject filter.
+func (n *KV) listKeysFiltered(ctx context.Context, filter string) ([]string, error) {
+	keys := make([]string, 0)
+
+	watcher, err := n.store.Watch(ctx, filter, jetstream.IgnoreDeletes(), jetstream.MetaOnly())
+	if err != nil {
+		return keys, err
+	}
+	// nolint:errcheck
+	defer watcher.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return keys, ctx.Err()
+		case entry := <-watcher.Updates():
+			if entry == nil {
+				return keys, nil
+			}
+
+			keys = append(keys, entry.Key())
+		}
+	}
+}
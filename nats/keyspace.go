@@ -0,0 +1,117 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"strings"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const (
+	// randomKeyAttempts is the number of random revisions looked up by RandomKey
+	// before falling back to listing the keys.
+	randomKeyAttempts = 8
+
+	kvOperationHeader = "KV-Operation"
+)
+
+// subject returns the subject of the encoded key in the stream backing the bucket.
+func (n *KV) subject(key string) string {
+	return "$KV." + n.bucket + "." + key
+}
+
+// DBSize returns the number of keys in the key-value store, from the bucket status.
+func (n *KV) DBSize(ctx context.Context) (int, error) {
+	status, err := n.store.Status(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	bucketStatus, ok := status.(*jetstream.KeyValueBucketStatus)
+	if !ok {
+		return 0, ErrGeneral
+	}
+
+	// Removed keys leave no marker behind (see compact), so each subject is a key.
+	return int(bucketStatus.StreamInfo().State.NumSubjects), nil
+}
+
+// RandomKey returns a random key of the key-value store.
+func (n *KV) RandomKey(ctx context.Context) (string, error) {
+	status, err := n.store.Status(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	bucketStatus, ok := status.(*jetstream.KeyValueBucketStatus)
+	if !ok {
+		return "", ErrGeneral
+	}
+
+	state := bucketStatus.StreamInfo().State
+	if state.NumSubjects == 0 {
+		return "", ErrKeyNotFound
+	}
+
+	// Pick a random revision, skipping the ones that have been removed or replaced.
+	for i := 0; i < randomKeyAttempts; i++ {
+		// nolint:gosec
+		sequence := state.FirstSeq + rand.Uint64N(state.LastSeq-state.FirstSeq+1)
+
+		msg, errMsg := n.stream.GetMsg(ctx, sequence)
+		if errMsg != nil && errors.Is(errMsg, jetstream.ErrMsgNotFound) {
+			continue
+		} else if errMsg != nil {
+			return "", errMsg
+		}
+
+		key := n.encoding.decode(strings.TrimPrefix(msg.Subject, n.subject("")))
+
+		_, errGet := n.store.Get(ctx, key)
+		if errGet != nil && errors.Is(errGet, jetstream.ErrKeyNotFound) {
+			continue
+		} else if errGet != nil {
+			return "", errGet
+		}
+
+		return key, nil
+	}
+
+	keys, err := n.Keys(ctx, "*")
+	if err != nil {
+		return "", err
+	}
+
+	if len(keys) == 0 {
+		return "", ErrKeyNotFound
+	}
+
+	// nolint:gosec
+	return keys[rand.IntN(len(keys))], nil
+}
+
+// compact removes the marker left in the stream by the purge of the key, so that
+// the number of subjects of the stream is the number of keys.
+// Only the messages up to the marker are removed: a value written concurrently is kept.
+func (n *KV) compact(ctx context.Context, key string) {
+	subject := n.subject(n.encoding.encode(key))
+
+	msg, err := n.stream.GetLastMsgForSubject(ctx, subject)
+	if err != nil && errors.Is(err, jetstream.ErrMsgNotFound) {
+		return
+	} else if err != nil {
+		n.log.Warn("Error compacting key", "key", key, "error", err)
+		return
+	}
+
+	if msg.Header.Get(kvOperationHeader) == "" {
+		return
+	}
+
+	err = n.stream.Purge(ctx, jetstream.WithPurgeSubject(subject), jetstream.WithPurgeSequence(msg.Sequence+1))
+	if err != nil {
+		n.log.Warn("Error compacting key", "key", key, "error", err)
+	}
+}
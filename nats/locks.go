@@ -0,0 +1,59 @@
+package nats
+
+import (
+	"hash/fnv"
+	"slices"
+	"sync"
+)
+
+// keyLockStripes is the number of locks the keys of a bucket are distributed on.
+const keyLockStripes = 1024
+
+// keyLocks is a set of striped read-write locks: each key is guarded by
+// one of the stripes, so commands on unrelated keys can proceed in parallel.
+type keyLocks struct {
+	stripes [keyLockStripes]sync.RWMutex
+}
+
+// stripesOf returns the stripes guarding the keys, sorted and without
+// duplicates, so that they are always acquired in the same order.
+func stripesOf(keys []string) []int {
+	stripes := make([]int, 0, len(keys))
+	for _, key := range keys {
+		hash := fnv.New32a()
+		_, _ = hash.Write([]byte(key))
+		stripes = append(stripes, int(hash.Sum32()%keyLockStripes))
+	}
+
+	slices.Sort(stripes)
+
+	return slices.Compact(stripes)
+}
+
+// LockKeys acquires the write locks of the keys and returns the function releasing them.
+func (n *KV) LockKeys(keys ...string) func() {
+	stripes := stripesOf(keys)
+	for _, stripe := range stripes {
+		n.locks.stripes[stripe].Lock()
+	}
+
+	return func() {
+		for i := len(stripes) - 1; i >= 0; i-- {
+			n.locks.stripes[stripes[i]].Unlock()
+		}
+	}
+}
+
+// RLockKeys acquires the read locks of the keys and returns the function releasing them.
+func (n *KV) RLockKeys(keys ...string) func() {
+	stripes := stripesOf(keys)
+	for _, stripe := range stripes {
+		n.locks.stripes[stripe].RLock()
+	}
+
+	return func() {
+		for i := len(stripes) - 1; i >= 0; i-- {
+			n.locks.stripes[stripes[i]].RUnlock()
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package nats
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	nc "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// expirationCheckInterval is the interval between two expiration checks of the buckets.
+const expirationCheckInterval = 1 * time.Second
+
+// Manager owns the NATS connection and the JetStream context shared by
+// all the key-value stores, and hands out the key-value store of each bucket.
+type Manager struct {
+	m         sync.Mutex
+	url       string
+	options   Options
+	encoding  KeyEncoding
+	conn      *nc.Conn
+	jetstream jetstream.JetStream
+	buckets   map[string]*KV
+	// presence is the bucket where the running instances register themselves.
+	presence   jetstream.KeyValue
+	instanceID string
+	stop       chan struct{}
+	log        *slog.Logger
+}
+
+// NewManager creates a new NATS connection manager, storing the keys with the given encoding
+func NewManager(url string, options Options, encoding KeyEncoding) *Manager {
+	return &Manager{
+		url:      url,
+		options:  options,
+		encoding: encoding,
+		buckets:  make(map[string]*KV),
+		stop:     make(chan struct{}),
+		log:      slog.Default().With("module", "nats-manager"),
+	}
+}
+
+// Connect connects to the NATS server and starts the expiration check
+// of the opened key-value stores, which runs until the context is done.
+func (m *Manager) Connect(ctx context.Context) error {
+	err := m.encoding.validate()
+	if err != nil {
+		return err
+	}
+
+	options, err := m.options.natsOptions()
+	if err != nil {
+		return err
+	}
+
+	options = append(options,
+		nc.DisconnectErrHandler(func(_ *nc.Conn, err error) {
+			m.log.Warn("Disconnected from NATS server", "url", m.url, "error", err)
+		}),
+		nc.ReconnectHandler(func(conn *nc.Conn) {
+			m.log.Info("Reconnected to NATS server", "url", conn.ConnectedUrl())
+		}),
+	)
+
+	conn, err := nc.Connect(m.url, options...)
+	if err != nil {
+		return err
+	}
+
+	m.conn = conn
+	m.log.Info("Connected to NATS server", "url", m.url)
+
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	m.log.Info("Connected to NATS JetStream")
+
+	m.jetstream = js
+
+	go m.expirationLoop(ctx)
+
+	return nil
+}
+
+// Close stops the expiration check and closes the connection to the NATS server
+func (m *Manager) Close() {
+	if m.conn != nil {
+		close(m.stop)
+		m.unregister()
+		m.conn.Close()
+
+		m.log.Info("Disconnected from NATS server", "url", m.url)
+	}
+}
+
+// KV returns the key-value store of the bucket.
+// The bucket itself is only created, with the given configuration, when the key-value store is opened.
+func (m *Manager) KV(bucket string, config BucketConfig) *KV {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	kv, ok := m.buckets[bucket]
+	if !ok {
+		kv = newKV(m.jetstream, bucket, config, m.encoding)
+		m.buckets[bucket] = kv
+	}
+
+	return kv
+}
+
+// opened returns the opened key-value stores, in bucket order.
+func (m *Manager) opened() []*KV {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	kvs := make([]*KV, 0, len(m.buckets))
+	for _, kv := range m.buckets {
+		if kv.isOpen() {
+			kvs = append(kvs, kv)
+		}
+	}
+
+	slices.SortFunc(kvs, func(a, b *KV) int {
+		return strings.Compare(a.bucket, b.bucket)
+	})
+
+	return kvs
+}
+
+// expirationLoop purges the expired keys of the opened key-value stores.
+func (m *Manager) expirationLoop(ctx context.Context) {
+	m.log.Info("Starting expiration check")
+
+	for {
+		for _, kv := range m.opened() {
+			err := kv.checkExpiration(ctx)
+			if err != nil {
+				m.log.Error("Error checking expiration", "bucket", kv.expirationBucket, "error", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.stop:
+			return
+		case <-time.After(expirationCheckInterval):
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// mappingKey is the key of the mapping in the mapping bucket.
+const mappingKey = "mapping"
+
+// mappingRetryInterval is the interval between the attempts to apply a mapping
+// whose buckets could not be opened.
+const mappingRetryInterval = time.Second
+
+// Mapping maps the database IDs to the indexes of their buckets. It is stored in a
+// bucket shared by the instances using the same buckets, so that SWAPDB swaps the
+// databases for the clients of all the instances.
+type Mapping struct {
+	store jetstream.KeyValue
+	count int
+	log   *slog.Logger
+}
+
+// OpenMapping opens the mapping of count databases stored in the bucket.
+func (m *Manager) OpenMapping(ctx context.Context, bucket string, count int) (*Mapping, error) {
+	store, err := m.jetstream.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{Bucket: bucket})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Mapping{
+		store: store,
+		count: count,
+		log:   m.log.With("bucket", bucket),
+	}, nil
+}
+
+// identity returns the mapping of each database to its own bucket.
+func (mp *Mapping) identity() []int {
+	mapping := make([]int, mp.count)
+	for i := range mapping {
+		mapping[i] = i
+	}
+
+	return mapping
+}
+
+// parse decodes a stored mapping, which must be a permutation of the databases.
+func (mp *Mapping) parse(value []byte) ([]int, error) {
+	var mapping []int
+
+	err := json.Unmarshal(value, &mapping)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidMapping, err)
+	}
+
+	if len(mapping) != mp.count {
+		return nil, fmt.Errorf("%w: %d databases instead of %d", ErrInvalidMapping, len(mapping), mp.count)
+	}
+
+	seen := make([]bool, mp.count)
+	for _, bucket := range mapping {
+		if bucket < 0 || bucket >= mp.count || seen[bucket] {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidMapping, mapping)
+		}
+		seen[bucket] = true
+	}
+
+	return mapping, nil
+}
+
+// Get returns the current mapping and its revision, the identity and 0 if none is stored.
+func (mp *Mapping) Get(ctx context.Context) ([]int, uint64, error) {
+	entry, err := mp.store.Get(ctx, mappingKey)
+	if err != nil && errors.Is(err, jetstream.ErrKeyNotFound) {
+		return mp.identity(), 0, nil
+	} else if err != nil {
+		return nil, 0, err
+	}
+
+	mapping, err := mp.parse(entry.Value())
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return mapping, entry.Revision(), nil
+}
+
+// Reset maps each database to its own bucket again.
+func (mp *Mapping) Reset(ctx context.Context) error {
+	return mp.store.Purge(ctx, mappingKey)
+}
+
+// Swap swaps the buckets of two databases and returns the new mapping and its revision.
+// The mapping is updated as a compare-and-set, so concurrent swaps are not lost.
+func (mp *Mapping) Swap(ctx context.Context, first, second int) ([]int, uint64, error) {
+	for {
+		mapping, revision, err := mp.Get(ctx)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		mapping[first], mapping[second] = mapping[second], mapping[first]
+
+		value, err := json.Marshal(mapping)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if revision == 0 {
+			revision, err = mp.store.Create(ctx, mappingKey, value)
+		} else {
+			revision, err = mp.store.Update(ctx, mappingKey, value, revision)
+		}
+		if err != nil && errors.Is(err, jetstream.ErrKeyExists) {
+			mp.log.Debug("Mapping modified concurrently, retrying")
+			continue
+		} else if err != nil {
+			return nil, 0, err
+		}
+
+		return mapping, revision, nil
+	}
+}
+
+// Watch calls onChange with the mappings stored afterwards, by any instance,
+// and their revision, until the context is done. A mapping that onChange fails
+// to apply is retried until it is applied or a newer mapping is stored.
+func (mp *Mapping) Watch(ctx context.Context, onChange func([]int, uint64) error) error {
+	watcher, err := mp.store.Watch(ctx, mappingKey, jetstream.UpdatesOnly())
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		// nolint:errcheck
+		defer watcher.Stop()
+
+		var (
+			pending         []int
+			pendingRevision uint64
+			retry           <-chan time.Time
+		)
+
+		apply := func(mapping []int, revision uint64) {
+			retry = nil
+
+			errApply := onChange(mapping, revision)
+			if errApply != nil {
+				mp.log.Error("Error applying the database mapping", "revision", revision, "error", errApply)
+				pending, pendingRevision = mapping, revision
+				retry = time.After(mappingRetryInterval)
+			}
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-retry:
+				apply(pending, pendingRevision)
+			case entry, ok := <-watcher.Updates():
+				if !ok {
+					return
+				}
+
+				if entry == nil {
+					continue
+				}
+
+				mapping := mp.identity()
+				if entry.Operation() == jetstream.KeyValuePut {
+					var errParse error
+					mapping, errParse = mp.parse(entry.Value())
+					if errParse != nil {
+						mp.log.Error("Error reading the database mapping", "error", errParse)
+						continue
+					}
+				}
+
+				apply(mapping, entry.Revision())
+			}
+		}
+	}()
+
+	return nil
+}
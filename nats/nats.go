@@ -2,158 +2,253 @@ package nats
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
-	"fmt"
 	"log/slog"
+	"math"
+	"math/big"
+	"slices"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
-	nc "github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
 )
 
 // KV is a simple key-value store backed by NATS JetStream
 type KV struct {
-	m                sync.Mutex
-	url              string
+	locks            keyLocks
 	bucket           string
 	expirationBucket string
-	conn             *nc.Conn
 	jetstream        jetstream.JetStream
 	store            jetstream.KeyValue
+	stream           jetstream.Stream
 	expirationStore  jetstream.KeyValue
-	persist          bool
-	log              *slog.Logger
+	config           BucketConfig
+	encoding         KeyEncoding
+	openLock         sync.Mutex
+	opened           bool
+	// reconciled are the existing buckets whose configuration was checked at startup.
+	reconciled map[string]bool
+	log        *slog.Logger
 }
 
-// New creates a new NATS JetStream key-value store
-func New(url string, bucket string, persist bool) *KV {
+// newKV creates a new NATS JetStream key-value store on a shared JetStream context
+func newKV(js jetstream.JetStream, bucket string, config BucketConfig, encoding KeyEncoding) *KV {
 	return &KV{
-		url:              url,
+		jetstream:        js,
 		bucket:           bucket,
 		expirationBucket: "EXP-" + bucket,
-		persist:          persist,
+		config:           config,
+		encoding:         encoding,
+		reconciled:       make(map[string]bool),
 		log:              slog.Default().With("module", "nats-kv"),
 	}
 }
 
-// Connect connects to the NATS server
-func (n *KV) Connect(ctx context.Context) error {
-	nc, err := nc.Connect(n.url)
-	if err != nil {
-		return err
-	}
+// Open creates the buckets of the key-value store, if not already done
+func (n *KV) Open(ctx context.Context) error {
+	n.openLock.Lock()
+	defer n.openLock.Unlock()
 
-	n.conn = nc
-	n.log.Info("Connected to NATS server", "url", n.url)
+	if n.opened {
+		return nil
+	}
 
-	js, err := jetstream.New(nc)
+	err := n.storage(ctx)
 	if err != nil {
 		return err
 	}
 
-	n.log.Info("Connected to NATS JetStream")
-
-	n.jetstream = js
-
-	err = n.storage(ctx)
+	err = n.expirationStorage(ctx)
 	if err != nil {
 		return err
 	}
 
-	return n.expirationStorage(ctx)
+	n.opened = true
+
+	return nil
 }
 
-// Close closes the connection to the NATS server
-func (n *KV) Close() {
-	if n.conn != nil {
-		n.conn.Close()
+// isOpen reports whether the buckets of the key-value store have been created
+func (n *KV) isOpen() bool {
+	n.openLock.Lock()
+	defer n.openLock.Unlock()
 
-		n.log.Info("Disconnected from NATS server", "url", n.url)
-	}
+	return n.opened
+}
+
+// Bucket returns the name of the key-value store bucket
+func (n *KV) Bucket() string {
+	return n.bucket
 }
 
 func (n *KV) storage(ctx context.Context) error {
-	if !n.persist {
-		errDelete := n.jetstream.DeleteKeyValue(ctx, n.bucket)
-		if errDelete != nil && !errors.Is(errDelete, jetstream.ErrBucketNotFound) {
-			return errDelete
-		}
+	store, err := n.createBucket(ctx, n.bucket, n.config)
+	if err != nil {
+		return err
+	}
+
+	stream, err := n.jetstream.Stream(ctx, kvStreamPrefix+n.bucket)
+	if err != nil {
+		return err
 	}
 
-	store, err := n.jetstream.CreateKeyValue(
-		ctx,
-		jetstream.KeyValueConfig{
-			Bucket: n.bucket,
-		},
-	)
+	n.encoding, err = n.bucketEncoding(ctx, stream)
 	if err != nil {
 		return err
 	}
 
-	n.log.Info("Starting NATS JetStream Key-Value store", "bucket", n.bucket)
+	n.log.Info("Starting NATS JetStream Key-Value store", "bucket", n.bucket, "keyEncoding", n.encoding)
 
-	n.store = store
+	n.store = encodedKeyValue{KeyValue: store, encoding: n.encoding}
+	n.stream = stream
 
 	return nil
 }
 
 func (n *KV) expirationStorage(ctx context.Context) error {
-	if !n.persist {
-		errDelete := n.jetstream.DeleteKeyValue(ctx, n.expirationBucket)
-		if errDelete != nil && !errors.Is(errDelete, jetstream.ErrBucketNotFound) {
-			return errDelete
-		}
+	store, err := n.createBucket(ctx, n.expirationBucket, n.config.expirationConfig())
+	if err != nil {
+		return err
 	}
 
-	store, err := n.jetstream.CreateKeyValue(
-		ctx,
-		jetstream.KeyValueConfig{
-			Bucket: n.expirationBucket,
-		},
-	)
+	n.log.Info("Starting NATS JetStream Key-Value store", "bucket", n.expirationBucket)
+
+	n.expirationStore = encodedKeyValue{KeyValue: store, encoding: n.encoding}
+
+	return nil
+}
+
+// Set sets a key-value pair in the key-value store, removing the expiration of the key
+func (n *KV) Set(ctx context.Context, key string, value []byte) error {
+	err := n.put(ctx, key, encodeValue(TypeString, value))
 	if err != nil {
 		return err
 	}
 
-	n.log.Info("Starting NATS JetStream Key-Value store", "bucket", n.expirationBucket)
+	_, err = n.clearExpiration(ctx, key)
+	return err
+}
 
-	n.expirationStore = store
+// SetOptions are the conditions and the expiration of SetWithOptions.
+type SetOptions struct {
+	// NX only sets the key if it does not exist, XX only if it exists.
+	NX bool
+	XX bool
+	// Get requires the previous value, if any, to be a string.
+	Get bool
+	// ExpireAt is the expiration time of the key, zero to remove the expiration.
+	ExpireAt time.Time
+	// KeepTTL keeps the expiration of the key.
+	KeepTTL bool
+}
 
-	go func(ctx context.Context) {
-		n.log.Info("Starting expiration check", "bucket", n.expirationBucket)
-		for {
-			errExpiration := n.checkExpiration(ctx)
-			if errExpiration != nil {
-				break
+// SetWithOptions sets a key-value pair in the key-value store if the conditions
+// of the options are met, and then updates the expiration of the key.
+// It returns the previous string value, nil if there is none, and reports
+// whether the key was set.
+func (n *KV) SetWithOptions(ctx context.Context, key string, value []byte, options SetOptions) ([]byte, bool, error) {
+	var previous []byte
+
+	err := n.updateValue(ctx, key, func(stored []byte, found bool) ([]byte, error) {
+		previous = nil
+		if found {
+			valueType, data := decodeValue(stored, TypeString)
+			if valueType == TypeString {
+				previous = data
+			} else if options.Get {
+				return nil, ErrWrongType
 			}
-			<-time.After(1 * time.Second)
 		}
-	}(ctx)
 
-	return nil
-}
+		if options.NX && found {
+			return nil, ErrKeyExists
+		}
+
+		if options.XX && !found {
+			return nil, ErrKeyNotFound
+		}
 
-func (n *KV) Lock() {
-	n.m.Lock()
+		return encodeValue(TypeString, value), nil
+	})
+	if err != nil && (errors.Is(err, ErrKeyExists) || errors.Is(err, ErrKeyNotFound)) {
+		return previous, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	switch {
+	case options.KeepTTL:
+	case options.ExpireAt.IsZero():
+		_, err = n.clearExpiration(ctx, key)
+	case !options.ExpireAt.After(time.Now()):
+		_, err = n.Del(ctx, key)
+	default:
+		err = n.setExpiration(ctx, key, options.ExpireAt)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return previous, true, nil
 }
 
-func (n *KV) Unlock() {
-	n.m.Unlock()
+// GetDel gets the value of a key holding a string and removes the key.
+func (n *KV) GetDel(ctx context.Context, key string) ([]byte, error) {
+	for {
+		entry, err := n.store.Get(ctx, key)
+		if err != nil && errors.Is(err, jetstream.ErrKeyNotFound) {
+			return nil, ErrKeyNotFound
+		} else if err != nil {
+			return nil, err
+		}
+
+		valueType, data := decodeValue(entry.Value(), TypeString)
+		if valueType != TypeString {
+			return nil, ErrWrongType
+		}
+
+		err = n.purgeRevision(ctx, key, entry.Revision())
+		if err != nil && errors.Is(err, ErrKeyExists) {
+			n.log.Debug("Key modified concurrently, retrying", "key", key)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		_, err = n.clearExpiration(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+
+		return data, nil
+	}
 }
 
-// Set sets a key-value pair in the key-value store
-func (n *KV) Set(ctx context.Context, key, value string) error {
-	_, err := n.store.Put(ctx, key, []byte(value))
-	return err
+// SetNX sets a key-value pair in the key-value store only if the key does not exist.
+// It reports whether the key was set.
+func (n *KV) SetNX(ctx context.Context, key string, value []byte) (bool, error) {
+	err := n.update(ctx, key, TypeString, func(_ []byte, found bool) ([]byte, error) {
+		if found {
+			return nil, ErrKeyExists
+		}
+
+		return value, nil
+	})
+	if err != nil && (errors.Is(err, ErrKeyExists) || errors.Is(err, ErrWrongType)) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, nil
 }
 
 // MSet sets multiple key-value pairs in the key-value store
 func (n *KV) MSet(ctx context.Context, args ...string) error {
 	for i := 0; i < len(args); i += 2 {
-		err := n.Set(ctx, args[i], args[i+1])
+		err := n.Set(ctx, args[i], []byte(args[i+1]))
 		if err != nil {
 			return err
 		}
@@ -163,32 +258,37 @@ func (n *KV) MSet(ctx context.Context, args ...string) error {
 }
 
 // Get gets the value for a key in the key-value store
-func (n *KV) Get(ctx context.Context, key string) (string, error) {
-	entry, err := n.store.Get(ctx, key)
-	if err != nil && errors.Is(err, jetstream.ErrKeyNotFound) {
-		return "", ErrKeyNotFound
-	} else if err != nil {
-		return "", err
-	}
-	return string(entry.Value()), nil
+func (n *KV) Get(ctx context.Context, key string) ([]byte, error) {
+	return n.get(ctx, key, TypeString)
 }
 
-// MGet gets the values for multiple keys in the key-value store
-func (n *KV) MGet(ctx context.Context, keys ...string) ([]string, error) {
-	var natsKeys []string
+// MGet gets the values for multiple keys in the key-value store.
+// Missing keys and keys not holding a string are reported as nil values.
+func (n *KV) MGet(ctx context.Context, keys ...string) ([][]byte, error) {
+	values := make([][]byte, 0, len(keys))
 	for _, key := range keys {
 		entry, err := n.store.Get(ctx, key)
 		if err != nil && errors.Is(err, jetstream.ErrKeyNotFound) {
-			natsKeys = append(natsKeys, "")
+			values = append(values, nil)
 			continue
 		} else if err != nil {
-			return keys, err
+			return nil, err
+		}
+
+		valueType, value := decodeValue(entry.Value(), TypeString)
+		if valueType != TypeString {
+			values = append(values, nil)
+			continue
 		}
 
-		natsKeys = append(natsKeys, string(entry.Value()))
+		if value == nil {
+			value = []byte{}
+		}
+
+		values = append(values, value)
 	}
 
-	return natsKeys, nil
+	return values, nil
 }
 
 // Del deletes a key from the key-value store
@@ -201,16 +301,34 @@ func (n *KV) Del(ctx context.Context, keys ...string) (int, error) {
 			continue
 		}
 
-		err = n.store.Purge(ctx, key)
+		err = n.purge(ctx, key)
 		if err != nil {
 			return deletedKeys, err
 		}
 		deletedKeys++
+
+		_, err = n.clearExpiration(ctx, key)
+		if err != nil {
+			return deletedKeys, err
+		}
 	}
 
 	return deletedKeys, nil
 }
 
+// Revision gets the current revision of a key in the key-value store.
+// A missing key has revision 0.
+func (n *KV) Revision(ctx context.Context, key string) (uint64, error) {
+	entry, err := n.store.Get(ctx, key)
+	if err != nil && errors.Is(err, jetstream.ErrKeyNotFound) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	return entry.Revision(), nil
+}
+
 // Exists checks if a key exists in the key-value store
 func (n *KV) Exists(ctx context.Context, keys ...string) (int, error) {
 	exists := 0
@@ -230,13 +348,14 @@ func (n *KV) Exists(ctx context.Context, keys ...string) (int, error) {
 func (n *KV) Keys(ctx context.Context, pattern string) ([]string, error) {
 	keys := make([]string, 0)
 
-	keyListener, err := n.store.ListKeys(ctx)
+	// Only the keys sharing the literal prefix of the pattern are listed
+	candidates, err := n.ListKeysFiltered(ctx, n.encoding.subjectFilters(pattern)...)
 	if err != nil {
 		return keys, err
 	}
 
-	for k := range keyListener.Keys() {
-		if matchPattern(k, pattern) {
+	for _, k := range candidates {
+		if MatchPattern(k, pattern) {
 			keys = append(keys, k)
 		}
 	}
@@ -245,85 +364,273 @@ func (n *KV) Keys(ctx context.Context, pattern string) ([]string, error) {
 }
 
 // Incr increments a key in the key-value store
-func (n *KV) Incr(ctx context.Context, key string) (int, error) {
-	value, err := n.Get(ctx, key)
-	if err != nil && errors.Is(err, ErrKeyNotFound) {
-		value = "0"
-	} else if err != nil {
+func (n *KV) Incr(ctx context.Context, key string) (int64, error) {
+	return n.IncrBy(ctx, key, 1)
+}
+
+// Decr decrements a key in the key-value store
+func (n *KV) Decr(ctx context.Context, key string) (int64, error) {
+	return n.IncrBy(ctx, key, -1)
+}
+
+// IncrBy adds the increment to the integer value of a key in the key-value store
+func (n *KV) IncrBy(ctx context.Context, key string, increment int64) (int64, error) {
+	var valueAsInt int64
+
+	err := n.update(ctx, key, TypeString, func(value []byte, found bool) ([]byte, error) {
+		if !found {
+			value = []byte("0")
+		}
+
+		var errParse error
+		valueAsInt, errParse = strconv.ParseInt(string(value), 10, 64)
+		if errParse != nil {
+			return nil, ErrNotInteger
+		}
+
+		if (increment > 0 && valueAsInt > math.MaxInt64-increment) ||
+			(increment < 0 && valueAsInt < math.MinInt64-increment) {
+			return nil, ErrOverflow
+		}
+
+		valueAsInt += increment
+
+		return []byte(strconv.FormatInt(valueAsInt, 10)), nil
+	})
+	if err != nil {
 		return 0, err
 	}
 
-	valueAsInt, err := strconv.Atoi(value)
+	return valueAsInt, nil
+}
+
+// IncrByFloat adds the increment to the floating point value of a key in the
+// key-value store and returns the new value, formatted as Redis does.
+func (n *KV) IncrByFloat(ctx context.Context, key string, increment string) (string, error) {
+	var result string
+
+	err := n.update(ctx, key, TypeString, func(value []byte, found bool) ([]byte, error) {
+		if !found {
+			value = []byte("0")
+		}
+
+		valueAsFloat, errParse := parseLongDouble(string(value))
+		if errParse != nil {
+			return nil, ErrNotFloat
+		}
+
+		incrementAsFloat, errParse := parseLongDouble(increment)
+		if errParse != nil {
+			return nil, ErrNotFloat
+		}
+
+		if valueAsFloat.IsInf() || incrementAsFloat.IsInf() {
+			return nil, ErrNaNOrInfinity
+		}
+
+		sum := new(big.Float).SetPrec(longDoublePrecision).Add(valueAsFloat, incrementAsFloat)
+		if sum.MantExp(nil) > longDoubleMaxExp {
+			return nil, ErrNaNOrInfinity
+		}
+
+		result = formatLongDouble(sum)
+
+		return []byte(result), nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return result, nil
+}
+
+// longDoublePrecision and longDoubleMaxExp are the mantissa bits and the
+// maximum exponent of the long double Redis uses for INCRBYFLOAT.
+const (
+	longDoublePrecision = 64
+	longDoubleMaxExp    = 16384
+)
+
+// parseLongDouble parses a decimal floating point value with long double precision.
+func parseLongDouble(value string) (*big.Float, error) {
+	if value == "" || strings.TrimSpace(value) != value {
+		return nil, ErrNotFloat
+	}
+
+	parsed, _, err := big.ParseFloat(value, 10, longDoublePrecision, big.ToNearestEven)
 	if err != nil {
-		return 0, err
+		return nil, ErrNotFloat
+	}
+
+	return parsed, nil
+}
+
+// formatLongDouble formats the value with 17 digits after the decimal point
+// and without trailing zeros, like Redis does.
+func formatLongDouble(value *big.Float) string {
+	formatted := value.Text('f', 17)
+	formatted = strings.TrimRight(formatted, "0")
+	formatted = strings.TrimSuffix(formatted, ".")
+
+	if formatted == "-0" {
+		return "0"
 	}
 
-	valueAsInt++
+	return formatted
+}
+
+// maxStringLength is the maximum length of a string value, like the Redis proto-max-bulk-len.
+const maxStringLength = 512 * 1024 * 1024
 
-	err = n.Set(ctx, key, fmt.Sprintf("%d", valueAsInt))
+// Append appends the value to the string value of a key in the key-value store
+// and returns the new length of the value.
+func (n *KV) Append(ctx context.Context, key string, value []byte) (int, error) {
+	var length int
+
+	err := n.update(ctx, key, TypeString, func(data []byte, found bool) ([]byte, error) {
+		if len(data) > maxStringLength-len(value) {
+			return nil, ErrStringTooLong
+		}
+
+		data = slices.Concat(data, value)
+		length = len(data)
+
+		return data, nil
+	})
 	if err != nil {
 		return 0, err
 	}
 
-	return valueAsInt, nil
+	return length, nil
 }
 
-// Decr decrements a key in the key-value store
-func (n *KV) Decr(ctx context.Context, key string) (int, error) {
-	value, err := n.Get(ctx, key)
+// StrLen returns the length of the string value of a key in the key-value store,
+// zero if the key does not exist.
+func (n *KV) StrLen(ctx context.Context, key string) (int, error) {
+	value, err := n.get(ctx, key, TypeString)
 	if err != nil && errors.Is(err, ErrKeyNotFound) {
-		value = "0"
+		return 0, nil
 	} else if err != nil {
 		return 0, err
 	}
 
-	valueAsInt, err := strconv.Atoi(value)
-	if err != nil {
-		return 0, err
+	return len(value), nil
+}
+
+// GetRange returns the substring of the string value of a key in the key-value store
+// between the start and end offsets, both included. Negative offsets start from the end.
+func (n *KV) GetRange(ctx context.Context, key string, start, end int64) ([]byte, error) {
+	value, err := n.get(ctx, key, TypeString)
+	if err != nil && errors.Is(err, ErrKeyNotFound) {
+		return []byte{}, nil
+	} else if err != nil {
+		return nil, err
 	}
 
-	valueAsInt--
+	length := int64(len(value))
 
-	err = n.Set(ctx, key, fmt.Sprintf("%d", valueAsInt))
-	if err != nil {
-		return 0, err
+	if start < 0 && end < 0 && start > end {
+		return []byte{}, nil
 	}
 
-	return valueAsInt, nil
+	if start < 0 {
+		start = max(length+start, 0)
+	}
+
+	if end < 0 {
+		end = max(length+end, 0)
+	}
+
+	end = min(end, length-1)
+
+	if start > end || length == 0 {
+		return []byte{}, nil
+	}
+
+	return value[start : end+1], nil
 }
 
-// HSet sets a field in a hash in the key-value store
-func (n *KV) HSet(ctx context.Context, key string, fieldsValues ...string) (int, error) {
-	hash := make(map[string]string)
+// SetRange overwrites the string value of a key in the key-value store from the offset,
+// padding the value with zero bytes if it is shorter than the offset.
+// It returns the new length of the value.
+func (n *KV) SetRange(ctx context.Context, key string, offset int64, value []byte) (int, error) {
+	if len(value) == 0 {
+		return n.StrLen(ctx, key)
+	}
 
-	entry, err := n.store.Get(ctx, key)
-	if err != nil && errors.Is(err, jetstream.ErrKeyNotFound) {
-		// do nothing
-		_ = err
-	} else if err != nil {
-		return 0, err
-	} else {
-		err = json.Unmarshal(entry.Value(), &hash)
-		if err != nil {
-			return 0, err
+	var length int
+
+	err := n.update(ctx, key, TypeString, func(data []byte, found bool) ([]byte, error) {
+		if offset > int64(maxStringLength-len(value)) {
+			return nil, ErrStringTooLong
 		}
+
+		end := int(offset) + len(value)
+
+		updated := make([]byte, max(len(data), end))
+		copy(updated, data)
+		copy(updated[offset:], value)
+		length = len(updated)
+
+		return updated, nil
+	})
+	if err != nil {
+		return 0, err
 	}
 
-	added := 0
-	for i := 0; i < len(fieldsValues); i += 2 {
-		if _, ok := hash[fieldsValues[i]]; !ok {
-			added++
+	return length, nil
+}
+
+// LCS returns the longest common subsequence of the string values of two keys
+// in the key-value store, reading missing keys as empty strings, and its
+// matching ranges at least minMatchLen long, from the last one.
+func (n *KV) LCS(ctx context.Context, key1, key2 string, minMatchLen int) ([]byte, []LCSMatch, error) {
+	values := make([][]byte, 0, 2)
+	for _, key := range []string{key1, key2} {
+		value, err := n.get(ctx, key, TypeString)
+		if err != nil && errors.Is(err, ErrKeyNotFound) {
+			value = []byte{}
+		} else if err != nil {
+			return nil, nil, err
 		}
 
-		hash[fieldsValues[i]] = fieldsValues[i+1]
+		values = append(values, value)
 	}
 
-	data, err := json.Marshal(hash)
-	if err != nil {
-		return 0, err
+	if uint64(len(values[0])+1)*uint64(len(values[1])+1)*4 > maxStringLength {
+		return nil, nil, ErrLCSTooLarge
 	}
 
-	_, err = n.store.Put(ctx, key, data)
+	lcs, matches := longestCommonSubsequence(values[0], values[1], minMatchLen)
+
+	return lcs, matches, nil
+}
+
+// HSet sets a field in a hash in the key-value store
+func (n *KV) HSet(ctx context.Context, key string, fieldsValues ...string) (int, error) {
+	added := 0
+
+	err := n.update(ctx, key, TypeHash, func(value []byte, found bool) ([]byte, error) {
+		hash := make(map[string]string)
+		if found {
+			var errDecode error
+			hash, errDecode = decodeHash(value)
+			if errDecode != nil {
+				return nil, errDecode
+			}
+		}
+
+		added = 0
+		for i := 0; i < len(fieldsValues); i += 2 {
+			if _, ok := hash[fieldsValues[i]]; !ok {
+				added++
+			}
+
+			hash[fieldsValues[i]] = fieldsValues[i+1]
+		}
+
+		return encodeHash(hash), nil
+	})
 	if err != nil {
 		return 0, err
 	}
@@ -333,16 +640,12 @@ func (n *KV) HSet(ctx context.Context, key string, fieldsValues ...string) (int,
 
 // HGet gets the value for a field in a hash in the key-value store
 func (n *KV) HGet(ctx context.Context, key, field string) (string, error) {
-	hash := make(map[string]string)
-
-	entry, err := n.store.Get(ctx, key)
-	if err != nil && errors.Is(err, jetstream.ErrKeyNotFound) {
-		return "", ErrKeyNotFound
-	} else if err != nil {
+	data, err := n.get(ctx, key, TypeHash)
+	if err != nil {
 		return "", err
 	}
 
-	err = json.Unmarshal(entry.Value(), &hash)
+	hash, err := decodeHash(data)
 	if err != nil {
 		return "", err
 	}
@@ -357,35 +660,33 @@ func (n *KV) HGet(ctx context.Context, key, field string) (string, error) {
 
 // HDel deletes a field from a hash in the key-value store
 func (n *KV) HDel(ctx context.Context, key string, fields ...string) (int, error) {
-	hash := make(map[string]string)
-
-	entry, err := n.store.Get(ctx, key)
-	if err != nil && errors.Is(err, jetstream.ErrKeyNotFound) {
-		return 0, ErrKeyNotFound
-	} else if err != nil {
-		return 0, err
-	}
+	deleted := 0
 
-	err = json.Unmarshal(entry.Value(), &hash)
-	if err != nil {
-		return 0, err
-	}
+	err := n.update(ctx, key, TypeHash, func(value []byte, found bool) ([]byte, error) {
+		if !found {
+			return nil, ErrKeyNotFound
+		}
 
-	deleted := 0
-	for _, field := range fields {
-		if _, ok := hash[field]; ok {
-			deleted++
+		hash, errDecode := decodeHash(value)
+		if errDecode != nil {
+			return nil, errDecode
 		}
 
-		delete(hash, field)
-	}
+		deleted = 0
+		for _, field := range fields {
+			if _, ok := hash[field]; ok {
+				deleted++
+			}
 
-	data, err := json.Marshal(hash)
-	if err != nil {
-		return 0, err
-	}
+			delete(hash, field)
+		}
+
+		if len(hash) == 0 {
+			return nil, errRemoveKey
+		}
 
-	_, err = n.store.Put(ctx, key, data)
+		return encodeHash(hash), nil
+	})
 	if err != nil {
 		return 0, err
 	}
@@ -395,16 +696,12 @@ func (n *KV) HDel(ctx context.Context, key string, fields ...string) (int, error
 
 // HGetAll gets all fields and values in a hash in the key-value store
 func (n *KV) HGetAll(ctx context.Context, key string) (map[string]string, error) {
-	hash := make(map[string]string)
-
-	entry, err := n.store.Get(ctx, key)
-	if err != nil && errors.Is(err, jetstream.ErrKeyNotFound) {
-		return nil, ErrKeyNotFound
-	} else if err != nil {
+	data, err := n.get(ctx, key, TypeHash)
+	if err != nil {
 		return nil, err
 	}
 
-	err = json.Unmarshal(entry.Value(), &hash)
+	hash, err := decodeHash(data)
 	if err != nil {
 		return nil, err
 	}
@@ -414,16 +711,12 @@ func (n *KV) HGetAll(ctx context.Context, key string) (map[string]string, error)
 
 // HKeys gets all fields in a hash in the key-value store
 func (n *KV) HKeys(ctx context.Context, key string) ([]string, error) {
-	hash := make(map[string]string)
-
-	entry, err := n.store.Get(ctx, key)
-	if err != nil && errors.Is(err, jetstream.ErrKeyNotFound) {
-		return nil, ErrKeyNotFound
-	} else if err != nil {
+	data, err := n.get(ctx, key, TypeHash)
+	if err != nil {
 		return nil, err
 	}
 
-	err = json.Unmarshal(entry.Value(), &hash)
+	hash, err := decodeHash(data)
 	if err != nil {
 		return nil, err
 	}
@@ -438,16 +731,12 @@ func (n *KV) HKeys(ctx context.Context, key string) ([]string, error) {
 
 // HLen gets the number of fields in a hash in the key-value store
 func (n *KV) HLen(ctx context.Context, key string) (int, error) {
-	hash := make(map[string]string)
-
-	entry, err := n.store.Get(ctx, key)
-	if err != nil && errors.Is(err, jetstream.ErrKeyNotFound) {
-		return 0, ErrKeyNotFound
-	} else if err != nil {
+	data, err := n.get(ctx, key, TypeHash)
+	if err != nil {
 		return 0, err
 	}
 
-	err = json.Unmarshal(entry.Value(), &hash)
+	hash, err := decodeHash(data)
 	if err != nil {
 		return 0, err
 	}
@@ -457,16 +746,12 @@ func (n *KV) HLen(ctx context.Context, key string) (int, error) {
 
 // HExists checks if a field exists in a hash in the key-value store
 func (n *KV) HExists(ctx context.Context, key, field string) (bool, error) {
-	hash := make(map[string]string)
-
-	entry, err := n.store.Get(ctx, key)
-	if err != nil && errors.Is(err, jetstream.ErrKeyNotFound) {
-		return false, ErrKeyNotFound
-	} else if err != nil {
+	data, err := n.get(ctx, key, TypeHash)
+	if err != nil {
 		return false, err
 	}
 
-	err = json.Unmarshal(entry.Value(), &hash)
+	hash, err := decodeHash(data)
 	if err != nil {
 		return false, err
 	}
@@ -481,65 +766,61 @@ func (n *KV) HExists(ctx context.Context, key, field string) (bool, error) {
 
 // LPush pushes values to a list in the key-value store
 func (n *KV) LPush(ctx context.Context, key string, values ...string) (int, error) {
-	list := make([]string, 0)
-
-	entry, err := n.store.Get(ctx, key)
-	if err != nil && errors.Is(err, jetstream.ErrKeyNotFound) {
-		// do nothing
-		_ = err
-	} else if err != nil {
-		return 0, err
-	} else {
-		err = json.Unmarshal(entry.Value(), &list)
-		if err != nil {
-			return 0, err
+	length := 0
+
+	err := n.update(ctx, key, TypeList, func(value []byte, found bool) ([]byte, error) {
+		list := make([]string, 0)
+		if found {
+			var errDecode error
+			list, errDecode = decodeList(value)
+			if errDecode != nil {
+				return nil, errDecode
+			}
 		}
-	}
 
-	for _, value := range values {
-		list = append([]string{value}, list...)
-	}
+		for _, value := range values {
+			list = append([]string{value}, list...)
+		}
 
-	data, err := json.Marshal(list)
-	if err != nil {
-		return 0, err
-	}
+		length = len(list)
 
-	_, err = n.store.Put(ctx, key, data)
+		return encodeList(list), nil
+	})
 	if err != nil {
 		return 0, err
 	}
 
-	return len(list), nil
+	return length, nil
 }
 
 // LPop pops a value from a list in the key-value store
 func (n *KV) LPop(ctx context.Context, key string, count int) ([]string, error) {
-	list := make([]string, 0)
+	var popped []string
 
-	entry, err := n.Get(ctx, key)
-	if err != nil && errors.Is(err, ErrKeyNotFound) {
-		return nil, ErrKeyNotFound
-	}
+	err := n.update(ctx, key, TypeList, func(value []byte, found bool) ([]byte, error) {
+		if !found {
+			return nil, ErrKeyNotFound
+		}
 
-	err = json.Unmarshal([]byte(entry), &list)
-	if err != nil {
-		return nil, err
-	}
+		list, errDecode := decodeList(value)
+		if errDecode != nil {
+			return nil, errDecode
+		}
 
-	if count > len(list) {
-		count = len(list)
-	}
+		popCount := count
+		if popCount > len(list) {
+			popCount = len(list)
+		}
 
-	popped := list[:count]
-	list = list[count:]
+		popped = list[:popCount]
+		list = list[popCount:]
 
-	data, err := json.Marshal(list)
-	if err != nil {
-		return nil, err
-	}
+		if len(list) == 0 {
+			return nil, errRemoveKey
+		}
 
-	_, err = n.store.Put(ctx, key, data)
+		return encodeList(list), nil
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -549,16 +830,12 @@ func (n *KV) LPop(ctx context.Context, key string, count int) ([]string, error)
 
 // LRange gets a range of values from a list in the key-value store
 func (n *KV) LRange(ctx context.Context, key string, start, stop int) ([]string, error) {
-	list := make([]string, 0)
-
-	entry, err := n.store.Get(ctx, key)
-	if err != nil && errors.Is(err, jetstream.ErrKeyNotFound) {
-		return nil, ErrKeyNotFound
-	} else if err != nil {
+	data, err := n.get(ctx, key, TypeList)
+	if err != nil {
 		return nil, err
 	}
 
-	err = json.Unmarshal(entry.Value(), &list)
+	list, err := decodeList(data)
 	if err != nil {
 		return nil, err
 	}
@@ -583,7 +860,7 @@ func (n *KV) LRange(ctx context.Context, key string, start, stop int) ([]string,
 	if stop >= listLen {
 		stop = listLen - 1 // Clamp stop to the end of the slice
 	}
-	if stop < 0 {
+	if stop < 0 || start > stop {
 		return []string{}, nil // Stop is before the start, return empty
 	}
 
@@ -591,19 +868,87 @@ func (n *KV) LRange(ctx context.Context, key string, start, stop int) ([]string,
 	return list[start : stop+1], nil
 }
 
-func (n *KV) Expire(ctx context.Context, key string, ttl time.Duration) error {
-	_, err := n.Get(ctx, key)
-	if err != nil && errors.Is(err, ErrKeyNotFound) {
-		return ErrKeyNotFound
+// Move moves a key, with its expiration, to the target key-value store.
+// It reports false if the key already exists in the target key-value store.
+// The key is removed from the source only if it was not modified while being
+// copied, otherwise the copy is removed and the move retried.
+func (n *KV) Move(ctx context.Context, key string, target *KV) (bool, error) {
+	for {
+		entry, err := n.store.Get(ctx, key)
+		if err != nil && errors.Is(err, jetstream.ErrKeyNotFound) {
+			return false, ErrKeyNotFound
+		} else if err != nil {
+			return false, err
+		}
+
+		// The value is copied as stored, with its type
+		revision, err := target.create(ctx, key, entry.Value())
+		if err != nil && errors.Is(err, ErrKeyExists) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+
+		expiration, err := n.expirationStore.Get(ctx, key)
+		if err != nil && !errors.Is(err, jetstream.ErrKeyNotFound) {
+			return false, err
+		}
+
+		hasExpiration := err == nil
+		if hasExpiration {
+			err = target.setExpirationValue(ctx, key, expiration.Value())
+			if err != nil {
+				return false, err
+			}
+		}
+
+		err = n.purgeRevision(ctx, key, entry.Revision())
+		if err != nil && errors.Is(err, ErrKeyExists) {
+			// The key was modified while being copied: the copy is rolled back
+			errRollback := target.rollbackMove(ctx, key, revision, hasExpiration)
+			if errRollback != nil {
+				return false, errRollback
+			}
+
+			n.log.Debug("Key modified concurrently, retrying", "key", key)
+			continue
+		} else if err != nil {
+			return false, err
+		}
+
+		if hasExpiration {
+			_, err = n.clearExpiration(ctx, key)
+			if err != nil {
+				return false, err
+			}
+		}
+
+		return true, nil
+	}
+}
+
+// rollbackMove removes the copy of a key written by Move, unless it was modified since.
+func (n *KV) rollbackMove(ctx context.Context, key string, revision uint64, hasExpiration bool) error {
+	err := n.purgeRevision(ctx, key, revision)
+	if err != nil && errors.Is(err, ErrKeyExists) {
+		return nil
 	} else if err != nil {
 		return err
 	}
 
-	expirationTime := time.Now().Add(ttl).Unix()
+	if hasExpiration {
+		_, err = n.clearExpiration(ctx, key)
+		if err != nil {
+			return err
+		}
+	}
 
-	n.log.Info("Setting expiration", "key", key, "expiration", expirationTime)
-	_, err = n.expirationStore.Put(ctx, key, []byte(fmt.Sprintf("%d", expirationTime)))
-	return err
+	return nil
+}
+
+// Expire sets the time to live of an existing key.
+func (n *KV) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	return n.ExpireAt(ctx, key, time.Now().Add(ttl))
 }
 
 func (n *KV) TTL(ctx context.Context, key string) (int64, error) {
@@ -623,12 +968,13 @@ func (n *KV) TTL(ctx context.Context, key string) (int64, error) {
 		return 0, err
 	}
 
-	expirationTime, err := strconv.ParseInt(string(entry.Value()), 10, 64)
+	expiration, err := parseExpiration(entry.Value())
 	if err != nil {
 		return 0, err
 	}
 
-	return (expirationTime - time.Now().Unix()), nil
+	// Rounded to the nearest second, as Redis does
+	return (time.Until(expiration).Milliseconds() + 500) / 1000, nil
 }
 
 // nolint:gocognit
@@ -651,28 +997,20 @@ func (n *KV) checkExpiration(ctx context.Context) error {
 
 			key := event.Key()
 
-			expirationTime, errParse := strconv.ParseInt(string(event.Value()), 10, 64)
+			expiration, errParse := parseExpiration(event.Value())
 			if errParse != nil {
 				continue
 			}
 
-			if time.Now().Unix() >= expirationTime {
-				n.Lock()
-
-				n.log.Info("Key expired", "key", key)
-				errPurge := n.store.Purge(ctx, key)
-				if errPurge != nil {
-					n.Unlock()
-					continue
-				}
+			if !time.Now().Before(expiration) {
+				unlock := n.LockKeys(key)
 
-				errPurge = n.expirationStore.Purge(ctx, key)
-				if errPurge != nil {
-					n.Unlock()
-					continue
+				errExpire := n.expireKey(ctx, key, event.Revision())
+				if errExpire != nil {
+					n.log.Warn("Error removing expired key", "key", key, "error", errExpire)
 				}
 
-				n.Unlock()
+				unlock()
 			}
 		}
 	}
@@ -0,0 +1,91 @@
+package nats
+
+import (
+	"os"
+	"time"
+
+	nc "github.com/nats-io/nats.go"
+)
+
+// Options represents the NATS connection options.
+type Options struct {
+	// Name is the connection name reported to the NATS server.
+	Name string
+	// CredsFile is the user JWT and NKey seed file (.creds).
+	CredsFile string
+	// NKeyFile is the NKey seed file.
+	NKeyFile string
+	// User and Password are the user/password credentials.
+	User     string
+	Password string
+	// Token is the authentication token.
+	Token string
+	// TLSCertFile and TLSKeyFile are the client certificate and private key.
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSCAFile is the CA bundle used to verify the NATS server certificate.
+	TLSCAFile string
+	// ReconnectWait is the time to wait between reconnect attempts, 0 for the NATS default.
+	ReconnectWait time.Duration
+	// MaxReconnects is the maximum number of reconnect attempts, 0 for the NATS default
+	// and a negative value to reconnect forever.
+	MaxReconnects int
+	// PingInterval is the interval between client pings, 0 for the NATS default.
+	PingInterval time.Duration
+}
+
+// natsOptions converts the options to the nats.go connection options.
+func (o *Options) natsOptions() ([]nc.Option, error) {
+	var options []nc.Option
+
+	if o.Name != "" {
+		options = append(options, nc.Name(o.Name))
+	}
+
+	if o.CredsFile != "" {
+		// The file is read on each connection: a missing file is reported now instead
+		_, err := os.Stat(o.CredsFile)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, nc.UserCredentials(o.CredsFile))
+	}
+
+	if o.NKeyFile != "" {
+		option, err := nc.NkeyOptionFromSeed(o.NKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, option)
+	}
+
+	if o.User != "" {
+		options = append(options, nc.UserInfo(o.User, o.Password))
+	}
+
+	if o.Token != "" {
+		options = append(options, nc.Token(o.Token))
+	}
+
+	if o.TLSCertFile != "" || o.TLSKeyFile != "" {
+		options = append(options, nc.ClientCert(o.TLSCertFile, o.TLSKeyFile))
+	}
+
+	if o.TLSCAFile != "" {
+		options = append(options, nc.RootCAs(o.TLSCAFile))
+	}
+
+	if o.ReconnectWait > 0 {
+		options = append(options, nc.ReconnectWait(o.ReconnectWait))
+	}
+
+	if o.MaxReconnects != 0 {
+		options = append(options, nc.MaxReconnects(o.MaxReconnects))
+	}
+
+	if o.PingInterval > 0 {
+		options = append(options, nc.PingInterval(o.PingInterval))
+	}
+
+	return options, nil
+}
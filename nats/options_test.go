@@ -0,0 +1,215 @@
+package nats
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	nc "github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+	"github.com/stretchr/testify/require"
+)
+
+// testJWT is the user JWT of the test credentials file: the client does not validate it.
+const testJWT = "eyJ0eXAiOiJKV1QiLCJhbGciOiJlZDI1NTE5LW5rZXkifQ.e30.c2lnbmF0dXJl"
+
+// credsTemplate is the format of a credentials file, holding the user JWT and seed.
+const credsTemplate = `-----BEGIN NATS USER JWT-----
+%s
+------END NATS USER JWT------
+
+-----BEGIN USER NKEY SEED-----
+%s
+------END USER NKEY SEED------
+`
+
+// applyOptions converts the options and applies them to the default nats.go options.
+func applyOptions(t *testing.T, options Options) (nc.Options, error) {
+	t.Helper()
+
+	natsOptions, err := options.natsOptions()
+	if err != nil {
+		return nc.Options{}, err
+	}
+
+	opts := nc.GetDefaultOptions()
+	for _, option := range natsOptions {
+		err = option(&opts)
+		if err != nil {
+			return nc.Options{}, err
+		}
+	}
+
+	return opts, nil
+}
+
+// writeFile writes the content to a file of the test directory and returns its path.
+func writeFile(t *testing.T, name string, content []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, content, 0o600))
+
+	return path
+}
+
+// createUser returns a user key pair and its seed.
+func createUser(t *testing.T) (nkeys.KeyPair, []byte) {
+	t.Helper()
+
+	user, err := nkeys.CreateUser()
+	require.NoError(t, err)
+
+	seed, err := user.Seed()
+	require.NoError(t, err)
+
+	return user, seed
+}
+
+// requireSignature checks that the signature callback signs with the user key.
+func requireSignature(t *testing.T, opts nc.Options, user nkeys.KeyPair) {
+	t.Helper()
+
+	nonce := []byte("nonce")
+
+	signature, err := opts.SignatureCB(nonce)
+	require.NoError(t, err)
+	require.NoError(t, user.Verify(nonce, signature))
+}
+
+// writeCertificate writes a self-signed certificate and its private key, and returns their paths.
+func writeCertificate(t *testing.T) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "redis2nats"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := writeFile(t, "cert.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	keyFile := writeFile(t, "key.pem", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+
+	return certFile, keyFile
+}
+
+func TestNATSOptionsToken(t *testing.T) {
+	opts, err := applyOptions(t, Options{Name: "redis2nats", Token: "secret"})
+	require.NoError(t, err)
+
+	require.Equal(t, "redis2nats", opts.Name)
+	require.Equal(t, "secret", opts.Token)
+}
+
+func TestNATSOptionsUserPassword(t *testing.T) {
+	opts, err := applyOptions(t, Options{User: "user", Password: "password"})
+	require.NoError(t, err)
+
+	require.Equal(t, "user", opts.User)
+	require.Equal(t, "password", opts.Password)
+}
+
+func TestNATSOptionsCredsFile(t *testing.T) {
+	user, seed := createUser(t)
+
+	creds := fmt.Sprintf(credsTemplate, testJWT, seed)
+
+	opts, err := applyOptions(t, Options{CredsFile: writeFile(t, "user.creds", []byte(creds))})
+	require.NoError(t, err)
+
+	jwt, err := opts.UserJWT()
+	require.NoError(t, err)
+	require.Equal(t, testJWT, jwt)
+
+	requireSignature(t, opts, user)
+
+	_, err = applyOptions(t, Options{CredsFile: filepath.Join(t.TempDir(), "missing.creds")})
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestNATSOptionsNKeyFile(t *testing.T) {
+	user, seed := createUser(t)
+
+	publicKey, err := user.PublicKey()
+	require.NoError(t, err)
+
+	opts, err := applyOptions(t, Options{NKeyFile: writeFile(t, "user.nk", seed)})
+	require.NoError(t, err)
+
+	require.Equal(t, publicKey, opts.Nkey)
+	requireSignature(t, opts, user)
+
+	_, err = applyOptions(t, Options{NKeyFile: filepath.Join(t.TempDir(), "missing.nk")})
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestNATSOptionsTLSFiles(t *testing.T) {
+	certFile, keyFile := writeCertificate(t)
+
+	opts, err := applyOptions(t, Options{TLSCertFile: certFile, TLSKeyFile: keyFile, TLSCAFile: certFile})
+	require.NoError(t, err)
+
+	require.True(t, opts.Secure)
+
+	cert, err := opts.TLSCertCB()
+	require.NoError(t, err)
+	require.Equal(t, "redis2nats", cert.Leaf.Subject.CommonName)
+
+	pool, err := opts.RootCAsCB()
+	require.NoError(t, err)
+	require.True(t, pool.Equal(certPool(t, certFile)))
+
+	missingFile := filepath.Join(t.TempDir(), "missing.pem")
+
+	_, err = applyOptions(t, Options{TLSCertFile: missingFile, TLSKeyFile: keyFile})
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	_, err = applyOptions(t, Options{TLSCertFile: certFile, TLSKeyFile: missingFile})
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	_, err = applyOptions(t, Options{TLSCAFile: missingFile})
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+// certPool returns a pool holding the certificates of the file.
+func certPool(t *testing.T, file string) *x509.CertPool {
+	t.Helper()
+
+	content, err := os.ReadFile(file)
+	require.NoError(t, err)
+
+	pool := x509.NewCertPool()
+	require.True(t, pool.AppendCertsFromPEM(content))
+
+	return pool
+}
+
+func TestNATSOptionsReconnect(t *testing.T) {
+	opts, err := applyOptions(t, Options{ReconnectWait: time.Second, MaxReconnects: -1, PingInterval: time.Minute})
+	require.NoError(t, err)
+
+	require.Equal(t, time.Second, opts.ReconnectWait)
+	require.Equal(t, -1, opts.MaxReconnect)
+	require.Equal(t, time.Minute, opts.PingInterval)
+}
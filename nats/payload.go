@@ -0,0 +1,145 @@
+package nats
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// binaryPayload starts the binary-safe payload of hashes and lists. Earlier versions
+// stored them as JSON, which replaces the bytes that are not valid UTF-8, and whose
+// payloads start with '{' or '['.
+const binaryPayload = 0x00
+
+// encodeStrings encodes the elements as a binary-safe payload: each element is
+// prefixed by its length.
+func encodeStrings(elements ...string) []byte {
+	size := 1
+	for _, element := range elements {
+		size += binary.MaxVarintLen64 + len(element)
+	}
+
+	payload := make([]byte, 0, size)
+	payload = append(payload, binaryPayload)
+
+	for _, element := range elements {
+		payload = binary.AppendUvarint(payload, uint64(len(element)))
+		payload = append(payload, element...)
+	}
+
+	return payload
+}
+
+// decodeStrings decodes the elements of a binary-safe payload.
+func decodeStrings(payload []byte) ([]string, error) {
+	if len(payload) == 0 || payload[0] != binaryPayload {
+		return nil, ErrInvalidPayload
+	}
+
+	var elements []string
+	for data := payload[1:]; len(data) > 0; {
+		length, n := binary.Uvarint(data)
+		if n <= 0 || length > uint64(len(data)-n) {
+			return nil, ErrInvalidPayload
+		}
+
+		elements = append(elements, string(data[n:n+int(length)]))
+		data = data[n+int(length):]
+	}
+
+	return elements, nil
+}
+
+// isJSONPayload reports whether the payload of a hash or a list was stored as JSON.
+func isJSONPayload(payload []byte) bool {
+	return len(payload) > 0 && (payload[0] == '{' || payload[0] == '[')
+}
+
+// unmarshalJSONPayload decodes a JSON payload. A payload holding JSON of another
+// type is reported as ErrWrongType, one that cannot be decoded as ErrInvalidPayload.
+func unmarshalJSONPayload(payload []byte, v any) error {
+	err := json.Unmarshal(payload, v)
+
+	var typeError *json.UnmarshalTypeError
+	if err != nil && errors.As(err, &typeError) {
+		return ErrWrongType
+	} else if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidPayload, err)
+	}
+
+	return nil
+}
+
+// encodeHash encodes the fields and values of a hash, sorted by field.
+func encodeHash(hash map[string]string) []byte {
+	fields := make([]string, 0, len(hash))
+	for field := range hash {
+		fields = append(fields, field)
+	}
+
+	sort.Strings(fields)
+
+	fieldsValues := make([]string, 0, 2*len(fields))
+	for _, field := range fields {
+		fieldsValues = append(fieldsValues, field, hash[field])
+	}
+
+	return encodeStrings(fieldsValues...)
+}
+
+// decodeHash decodes the fields and values of a hash.
+func decodeHash(payload []byte) (map[string]string, error) {
+	hash := make(map[string]string)
+
+	if isJSONPayload(payload) {
+		err := unmarshalJSONPayload(payload, &hash)
+		if err != nil {
+			return nil, err
+		}
+
+		return hash, nil
+	}
+
+	fieldsValues, err := decodeStrings(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fieldsValues)%2 != 0 {
+		return nil, ErrInvalidPayload
+	}
+
+	for i := 0; i < len(fieldsValues); i += 2 {
+		hash[fieldsValues[i]] = fieldsValues[i+1]
+	}
+
+	return hash, nil
+}
+
+// encodeList encodes the elements of a list.
+func encodeList(list []string) []byte {
+	return encodeStrings(list...)
+}
+
+// decodeList decodes the elements of a list.
+func decodeList(payload []byte) ([]string, error) {
+	list := make([]string, 0)
+
+	if isJSONPayload(payload) {
+		err := unmarshalJSONPayload(payload, &list)
+		if err != nil {
+			return nil, err
+		}
+
+		return list, nil
+	}
+
+	elements, err := decodeStrings(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(list, elements...), nil
+}
@@ -0,0 +1,88 @@
+package nats
+
+import (
+	"context"
+	"strings"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// Scan returns the keys stored from the cursor on, up to count stream messages,
+// that match the pattern and, if not empty, the type.
+// Only the keys sharing the literal prefix of the pattern are read from the stream.
+// The cursor is a position in the stream backing the bucket: the next cursor
+// is 0 when the whole bucket has been scanned. As the latest revision of a key
+// is always after the revisions it replaces, a key stored for the whole scan
+// is returned at least once, and may be returned more than once.
+func (n *KV) Scan(ctx context.Context, cursor uint64, pattern string, count int, keyType string) ([]string, uint64, error) {
+	filters := n.encoding.subjectFilters(pattern)
+	for i, filter := range filters {
+		filters[i] = n.subject(filter)
+	}
+
+	config := jetstream.OrderedConsumerConfig{
+		FilterSubjects: filters,
+		HeadersOnly:    keyType == "",
+	}
+
+	if cursor > 0 {
+		config.DeliverPolicy = jetstream.DeliverByStartSequencePolicy
+		config.OptStartSeq = cursor
+	}
+
+	consumer, err := n.stream.OrderedConsumer(ctx, config)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	batch, err := consumer.FetchNoWait(count)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	keys := make([]string, 0)
+	next := uint64(0)
+
+	for msg := range batch.Messages() {
+		metadata, errMetadata := msg.Metadata()
+		if errMetadata != nil {
+			return nil, 0, errMetadata
+		}
+
+		next = metadata.Sequence.Stream + 1
+		if metadata.NumPending == 0 {
+			next = 0
+		}
+
+		if msg.Headers().Get(kvOperationHeader) != "" {
+			continue
+		}
+
+		key := n.encoding.decode(strings.TrimPrefix(msg.Subject(), n.subject("")))
+		if !MatchPattern(key, pattern) {
+			continue
+		}
+
+		if keyType != "" {
+			if valueType, _ := decodeValue(msg.Data(), keyType); valueType != keyType {
+				continue
+			}
+		}
+
+		keys = append(keys, key)
+	}
+
+	if batch.Error() != nil {
+		return nil, 0, batch.Error()
+	}
+
+	// The consumer is not reused by the next call: remove it instead of waiting for it to expire.
+	if info := consumer.CachedInfo(); info != nil {
+		errDelete := n.jetstream.DeleteConsumer(ctx, info.Stream, info.Name)
+		if errDelete != nil {
+			n.log.Debug("Error deleting scan consumer", "consumer", info.Name, "error", errDelete)
+		}
+	}
+
+	return keys, next, nil
+}
@@ -0,0 +1,176 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nuid"
+)
+
+const (
+	// StartupModeKeep keeps the existing buckets and their data.
+	StartupModeKeep = "keep"
+	// StartupModeFlushOnStart deletes the existing buckets, unless other instances are running.
+	StartupModeFlushOnStart = "flush-on-start"
+	// StartupModeFailIfExists refuses to start if any of the buckets already exists.
+	StartupModeFailIfExists = "fail-if-exists"
+
+	// presenceTTL is the time after which the presence key of a stopped instance expires.
+	presenceTTL = 30 * time.Second
+)
+
+// Register announces this instance in the presence bucket, shared by the instances
+// using the same buckets, until the manager is closed.
+func (m *Manager) Register(ctx context.Context, bucket string) error {
+	presence, err := m.jetstream.CreateOrUpdateKeyValue(
+		ctx,
+		jetstream.KeyValueConfig{
+			Bucket: bucket,
+			TTL:    presenceTTL,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	m.presence = presence
+	m.instanceID = nuid.Next()
+
+	_, err = m.presence.Put(ctx, m.instanceID, []byte(time.Now().UTC().Format(time.RFC3339)))
+	if err != nil {
+		return err
+	}
+
+	m.log.Info("Registered instance", "bucket", bucket, "instance", m.instanceID)
+
+	go m.presenceLoop(ctx)
+
+	return nil
+}
+
+// presenceLoop refreshes the presence key of this instance before it expires.
+func (m *Manager) presenceLoop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.stop:
+			return
+		case <-time.After(presenceTTL / 3):
+		}
+
+		_, err := m.presence.Put(ctx, m.instanceID, []byte(time.Now().UTC().Format(time.RFC3339)))
+		if err != nil {
+			m.log.Error("Error refreshing instance presence", "instance", m.instanceID, "error", err)
+		}
+	}
+}
+
+// unregister removes the presence key of this instance.
+func (m *Manager) unregister() {
+	if m.presence == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), presenceTTL)
+	defer cancel()
+
+	err := m.presence.Purge(ctx, m.instanceID)
+	if err != nil {
+		m.log.Error("Error removing instance presence", "instance", m.instanceID, "error", err)
+	}
+}
+
+// otherInstances returns the number of other registered instances.
+func (m *Manager) otherInstances(ctx context.Context) (int, error) {
+	lister, err := m.presence.ListKeys(ctx)
+	if err != nil {
+		return 0, err
+	}
+	// nolint:errcheck
+	defer lister.Stop()
+
+	instances := 0
+	for key := range lister.Keys() {
+		if key != m.instanceID {
+			instances++
+		}
+	}
+
+	return instances, nil
+}
+
+// Startup applies the startup mode to the buckets of the key-value stores.
+// Destructive modes are refused when other instances are registered.
+func (m *Manager) Startup(ctx context.Context, mode string, kvs []*KV) error {
+	switch mode {
+	case StartupModeKeep, "":
+		return nil
+	case StartupModeFlushOnStart:
+		if m.presence != nil {
+			instances, err := m.otherInstances(ctx)
+			if err != nil {
+				return err
+			}
+
+			if instances > 0 {
+				return fmt.Errorf("%w: %d other instances", ErrInstancesRunning, instances)
+			}
+		}
+
+		for _, kv := range kvs {
+			err := kv.deleteBuckets(ctx)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case StartupModeFailIfExists:
+		for _, kv := range kvs {
+			exists, err := kv.bucketExists(ctx)
+			if err != nil {
+				return err
+			}
+
+			if exists {
+				return fmt.Errorf("%w: %s", ErrBucketExists, kv.bucket)
+			}
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("%w: %s", ErrInvalidStartupMode, mode)
+	}
+}
+
+// deleteBuckets deletes the data and expiration buckets of the key-value store.
+func (n *KV) deleteBuckets(ctx context.Context) error {
+	for _, bucket := range []string{n.bucket, n.expirationBucket} {
+		err := n.jetstream.DeleteKeyValue(ctx, bucket)
+		if err != nil && errors.Is(err, jetstream.ErrBucketNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		n.log.Info("Deleted NATS JetStream Key-Value store", "bucket", bucket)
+	}
+
+	return nil
+}
+
+// bucketExists reports whether the data bucket of the key-value store exists.
+func (n *KV) bucketExists(ctx context.Context) (bool, error) {
+	_, err := n.jetstream.KeyValue(ctx, n.bucket)
+	if err != nil && errors.Is(err, jetstream.ErrBucketNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
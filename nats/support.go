@@ -1,8 +1,8 @@
 package nats
 
-// matchPattern checks if the string 's' matches the pattern 'pattern'.
+// MatchPattern checks if the string 's' matches the pattern 'pattern'.
 // nolint: gocognit,nestif,cyclop
-func matchPattern(s string, pattern string) bool {
+func MatchPattern(s string, pattern string) bool {
 	si, pi := 0, 0
 	sLen, pLen := len(s), len(pattern)
 
@@ -22,13 +22,16 @@ func matchPattern(s string, pattern string) bool {
 				}
 				pi++
 				for si <= sLen {
-					if matchPattern(s[si:], pattern[pi:]) {
+					if MatchPattern(s[si:], pattern[pi:]) {
 						return true
 					}
 					si++
 				}
 				return false
 			case '[': // Handle character sets or ranges
+				if si >= sLen {
+					return false
+				}
 				pi++
 				notSet := false
 				if pi < pLen && pattern[pi] == '^' {
@@ -75,3 +78,95 @@ func matchPattern(s string, pattern string) bool {
 	}
 	return si == sLen && pi == pLen
 }
+
+// LCSMatch is a range of the longest common subsequence found in both the values:
+// the offsets of its first and last bytes in each value and its length.
+type LCSMatch struct {
+	Start1, End1 int
+	Start2, End2 int
+	Length       int
+}
+
+// longestCommonSubsequence returns the longest common subsequence of a and b and
+// its matching ranges at least minMatchLen long, from the last one, as Redis LCS does.
+// nolint: gocognit,cyclop
+func longestCommonSubsequence(a, b []byte, minMatchLen int) ([]byte, []LCSMatch) {
+	aLen, bLen := len(a), len(b)
+
+	// table[i][j] is the length of the LCS of a[:i] and b[:j]
+	table := make([]uint32, (aLen+1)*(bLen+1))
+	lcsLen := func(i, j int) uint32 {
+		return table[j*(aLen+1)+i]
+	}
+
+	for i := 1; i <= aLen; i++ {
+		for j := 1; j <= bLen; j++ {
+			if a[i-1] == b[j-1] {
+				table[j*(aLen+1)+i] = lcsLen(i-1, j-1) + 1
+			} else {
+				table[j*(aLen+1)+i] = max(lcsLen(i-1, j), lcsLen(i, j-1))
+			}
+		}
+	}
+
+	idx := int(lcsLen(aLen, bLen))
+	lcs := make([]byte, idx)
+	matches := []LCSMatch{}
+
+	// Walk the table back from the end, collecting the contiguous ranges
+	aStart, aEnd, bStart, bEnd := aLen, 0, 0, 0
+	i, j := aLen, bLen
+	for i > 0 && j > 0 {
+		emitRange := false
+
+		if a[i-1] == b[j-1] {
+			lcs[idx-1] = a[i-1]
+
+			switch {
+			case aStart == aLen:
+				aStart, aEnd = i-1, i-1
+				bStart, bEnd = j-1, j-1
+			case aStart == i && bStart == j:
+				aStart--
+				bStart--
+			default:
+				emitRange = true
+			}
+
+			if aStart == 0 || bStart == 0 {
+				emitRange = true
+			}
+
+			idx--
+			i--
+			j--
+		} else {
+			if lcsLen(i-1, j) > lcsLen(i, j-1) {
+				i--
+			} else {
+				j--
+			}
+
+			if aStart != aLen {
+				emitRange = true
+			}
+		}
+
+		if emitRange {
+			matchLen := aEnd - aStart + 1
+			if minMatchLen == 0 || matchLen >= minMatchLen {
+				matches = append(matches, LCSMatch{
+					Start1: aStart,
+					End1:   aEnd,
+					Start2: bStart,
+					End2:   bEnd,
+					Length: matchLen,
+				})
+			}
+
+			aStart = aLen
+		}
+	}
+
+	return lcs, matches
+}
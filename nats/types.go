@@ -0,0 +1,92 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const (
+	TypeString = "string"
+	TypeHash   = "hash"
+	TypeList   = "list"
+
+	// valueMarker starts the envelope storing the type of a value before its data.
+	valueMarker = 0x00
+)
+
+// typeCodes are the codes of the types in the value envelope.
+var typeCodes = map[string]byte{
+	TypeString: 's',
+	TypeHash:   'h',
+	TypeList:   'l',
+}
+
+// encodeValue wraps the data of a value in an envelope carrying its type.
+func encodeValue(keyType string, data []byte) []byte {
+	value := make([]byte, 0, len(data)+2)
+	value = append(value, valueMarker, typeCodes[keyType])
+
+	return append(value, data...)
+}
+
+// decodeValue returns the type and the data of a stored value, read as keyType.
+// Values stored without an envelope, by earlier versions, are strings, unless
+// they are read as a hash or a list and hold the JSON encoding of that type.
+func decodeValue(value []byte, keyType string) (string, []byte) {
+	if len(value) >= 2 && value[0] == valueMarker {
+		for valueType, code := range typeCodes {
+			if value[1] == code {
+				return valueType, value[2:]
+			}
+		}
+	}
+
+	return legacyType(value, keyType), value
+}
+
+// legacyType returns the type of a value stored without an envelope, read as keyType:
+// hashes were stored as JSON objects and lists as JSON arrays.
+func legacyType(value []byte, keyType string) string {
+	switch {
+	case keyType == TypeHash && len(value) > 0 && value[0] == '{' && json.Valid(value):
+		return TypeHash
+	case keyType == TypeList && len(value) > 0 && value[0] == '[' && json.Valid(value):
+		return TypeList
+	default:
+		return TypeString
+	}
+}
+
+// get returns the data of a key holding a value of the given type.
+func (n *KV) get(ctx context.Context, key, keyType string) ([]byte, error) {
+	entry, err := n.store.Get(ctx, key)
+	if err != nil && errors.Is(err, jetstream.ErrKeyNotFound) {
+		return nil, ErrKeyNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	valueType, data := decodeValue(entry.Value(), keyType)
+	if valueType != keyType {
+		return nil, ErrWrongType
+	}
+
+	return data, nil
+}
+
+// Type returns the type of the value stored at a key.
+func (n *KV) Type(ctx context.Context, key string) (string, error) {
+	entry, err := n.store.Get(ctx, key)
+	if err != nil && errors.Is(err, jetstream.ErrKeyNotFound) {
+		return "", ErrKeyNotFound
+	} else if err != nil {
+		return "", err
+	}
+
+	keyType, _ := decodeValue(entry.Value(), TypeString)
+
+	return keyType, nil
+}
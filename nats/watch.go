@@ -0,0 +1,92 @@
+package nats
+
+import (
+	"context"
+	"errors"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// Watch records the revisions of the keys watched by a client.
+// A revision of 0 means that the key did not exist when it was watched.
+type Watch struct {
+	revisions map[*KV]map[string]uint64
+}
+
+// NewWatch creates an empty set of watched keys.
+func NewWatch() *Watch {
+	return &Watch{
+		revisions: make(map[*KV]map[string]uint64),
+	}
+}
+
+// Add records the current revision of the keys.
+// Keys that are already watched keep their original revision.
+func (w *Watch) Add(ctx context.Context, n *KV, keys ...string) error {
+	revisions, ok := w.revisions[n]
+	if !ok {
+		revisions = make(map[string]uint64)
+		w.revisions[n] = revisions
+	}
+
+	for _, key := range keys {
+		if _, ok := revisions[key]; ok {
+			continue
+		}
+
+		revision, err := n.Revision(ctx, key)
+		if err != nil {
+			return err
+		}
+
+		revisions[key] = revision
+	}
+
+	return nil
+}
+
+// Claim reports whether any watched key has been modified since it was watched.
+// Existing keys are checked by writing their value again, conditional on their
+// watched revision, instead of by reading their revision: a write of another
+// instance sharing the buckets either lands before the check and fails it, or
+// lands after it and is ordered before the writes that follow the check.
+func (w *Watch) Claim(ctx context.Context) (bool, error) {
+	for n, revisions := range w.revisions {
+		for key, watchedRevision := range revisions {
+			changed, err := n.claim(ctx, key, watchedRevision)
+			if err != nil {
+				return false, err
+			}
+
+			if changed {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// claim checks that the key is still at the given revision, writing its value again
+// conditional on that revision. A revision of 0 means that the key must not exist.
+func (n *KV) claim(ctx context.Context, key string, revision uint64) (bool, error) {
+	entry, err := n.store.Get(ctx, key)
+	if err != nil && errors.Is(err, jetstream.ErrKeyNotFound) {
+		return revision != 0, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if entry.Revision() != revision {
+		return true, nil
+	}
+
+	_, err = n.store.Update(ctx, key, entry.Value(), revision)
+	if err != nil && errors.Is(err, jetstream.ErrKeyExists) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return false, nil
+}
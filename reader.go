@@ -0,0 +1,251 @@
+package redisnats
+
+import (
+	"bufio"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const (
+	// redisMaxBulkLength mirrors the default proto-max-bulk-len of Redis (512MB).
+	redisMaxBulkLength = 512 * 1024 * 1024
+	// redisMaxArrayLength mirrors the maximum multibulk length accepted by Redis.
+	redisMaxArrayLength = 1024 * 1024
+	// redisMaxUnauthenticatedBulkLength and redisMaxUnauthenticatedArrayLength mirror
+	// the limits Redis applies to the clients that did not authenticate yet.
+	redisMaxUnauthenticatedBulkLength  = 16 * 1024
+	redisMaxUnauthenticatedArrayLength = 10
+	// redisMaxLineLength mirrors the maximum inline request length of Redis (64KB).
+	redisMaxLineLength = 64 * 1024
+	// bulkInitialBuffer bounds the buffer allocated for a bulk string before its data arrives.
+	bulkInitialBuffer = 64 * 1024
+)
+
+// readLine reads a single protocol line and strips the trailing CRLF (or LF).
+// Any other whitespace is preserved.
+func readLine(reader *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		chunk, err := reader.ReadSlice(redisLF)
+		if len(line)+len(chunk) > redisMaxLineLength {
+			return "", ErrLineTooLong
+		}
+
+		line = append(line, chunk...)
+
+		if err != nil && errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+
+		break
+	}
+
+	return strings.TrimSuffix(strings.TrimSuffix(string(line), "\n"), "\r"), nil
+}
+
+// readBulkString reads a RESP bulk string ($<length>\r\n<data>\r\n) of at most maxLength bytes.
+// The data is read according to the declared length, so it may contain
+// any byte sequence, including CR and LF.
+func readBulkString(reader *bufio.Reader, maxLength int) (string, error) {
+	header, err := readLine(reader)
+	if err != nil {
+		return "", err
+	}
+
+	// Make sure it starts with '$'
+	if !strings.HasPrefix(header, redisbulkStringPrefix) {
+		return "", expectedBulkError(header)
+	}
+
+	// Read the bulk string length
+	length, err := strconv.Atoi(header[1:])
+	if err != nil || length < 0 || length > redisMaxBulkLength {
+		return "", ErrInvalidBulkData
+	}
+
+	if length > maxLength {
+		return "", ErrUnauthenticatedBulkLength
+	}
+
+	// The data is copied as it arrives, so the declared length is not allocated upfront
+	var data strings.Builder
+	data.Grow(min(length, bulkInitialBuffer))
+	for remaining := length; remaining > 0; {
+		_, err = reader.Peek(1)
+		if err != nil {
+			return "", err
+		}
+
+		chunk, _ := reader.Peek(min(remaining, reader.Buffered()))
+		data.Write(chunk)
+		_, _ = reader.Discard(len(chunk))
+		remaining -= len(chunk)
+	}
+
+	// Read the terminating CRLF
+	terminator, err := reader.Peek(len(redisCRLF))
+	if err != nil {
+		return "", err
+	}
+
+	if string(terminator) != redisCRLF {
+		return "", ErrInvalidBulkData
+	}
+	_, _ = reader.Discard(len(redisCRLF))
+
+	return data.String(), nil
+}
+
+// readRESPArray reads the bulk strings of a RESP array whose header
+// (e.g. *3) has already been consumed.
+// The length of the array and of the bulk strings is limited until the client authenticates.
+func readRESPArray(reader *bufio.Reader, header string, authenticated bool) ([]string, error) {
+	// Parse the array length
+	arrayLength, err := strconv.Atoi(header[1:])
+	if err != nil || arrayLength > redisMaxArrayLength {
+		return nil, ErrInvalidCommand
+	}
+
+	// Empty arrays are ignored like empty inline commands
+	if arrayLength <= 0 {
+		return nil, nil
+	}
+
+	maxBulkLength := redisMaxBulkLength
+	if !authenticated {
+		if arrayLength > redisMaxUnauthenticatedArrayLength {
+			return nil, ErrUnauthenticatedArrayLength
+		}
+		maxBulkLength = redisMaxUnauthenticatedBulkLength
+	}
+
+	// Read each part of the array (command and arguments)
+	parts := make([]string, 0, arrayLength)
+	for i := 0; i < arrayLength; i++ {
+		part, errRead := readBulkString(reader, maxBulkLength)
+		if errRead != nil {
+			return nil, errRead
+		}
+
+		parts = append(parts, part)
+	}
+
+	return parts, nil
+}
+
+// parseInlineCommand splits an inline command line into arguments following
+// the Redis inline grammar: arguments are separated by whitespace and may be
+// enclosed in double quotes (supporting \n, \r, \t, \b, \a, \\, \" and \xHH
+// escapes) or single quotes (supporting the \' escape).
+// nolint:gocognit,cyclop
+func parseInlineCommand(line string) ([]string, error) {
+	var args []string
+
+	i := 0
+	for {
+		// Skip blanks
+		for i < len(line) && isInlineSpace(line[i]) {
+			i++
+		}
+		if i >= len(line) {
+			return args, nil
+		}
+
+		var current strings.Builder
+		inDoubleQuotes, inSingleQuotes, done := false, false, false
+		for !done {
+			switch {
+			case inDoubleQuotes:
+				if i >= len(line) {
+					return nil, ErrUnbalancedQuotes
+				}
+				switch {
+				case line[i] == '\\' && i+3 < len(line) && line[i+1] == 'x' &&
+					isHexDigit(line[i+2]) && isHexDigit(line[i+3]):
+					value, _ := strconv.ParseUint(line[i+2:i+4], 16, 8)
+					current.WriteByte(byte(value))
+					i += 3
+				case line[i] == '\\' && i+1 < len(line):
+					i++
+					current.WriteByte(unescapeInlineByte(line[i]))
+				case line[i] == '"':
+					// Closing quote must be followed by a space or nothing at all
+					if i+1 < len(line) && !isInlineSpace(line[i+1]) {
+						return nil, ErrUnbalancedQuotes
+					}
+					done = true
+				default:
+					current.WriteByte(line[i])
+				}
+			case inSingleQuotes:
+				if i >= len(line) {
+					return nil, ErrUnbalancedQuotes
+				}
+				switch {
+				case line[i] == '\\' && i+1 < len(line) && line[i+1] == '\'':
+					i++
+					current.WriteByte('\'')
+				case line[i] == '\'':
+					// Closing quote must be followed by a space or nothing at all
+					if i+1 < len(line) && !isInlineSpace(line[i+1]) {
+						return nil, ErrUnbalancedQuotes
+					}
+					done = true
+				default:
+					current.WriteByte(line[i])
+				}
+			default:
+				if i >= len(line) {
+					done = true
+					break
+				}
+				switch line[i] {
+				case ' ', '\n', '\r', '\t', 0:
+					done = true
+				case '"':
+					inDoubleQuotes = true
+				case '\'':
+					inSingleQuotes = true
+				default:
+					current.WriteByte(line[i])
+				}
+			}
+
+			if i < len(line) {
+				i++
+			}
+		}
+
+		args = append(args, current.String())
+	}
+}
+
+// unescapeInlineByte returns the byte represented by a backslash escape
+// inside a double quoted inline argument.
+func unescapeInlineByte(b byte) byte {
+	switch b {
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	case 'b':
+		return '\b'
+	case 'a':
+		return '\a'
+	default:
+		return b
+	}
+}
+
+func isInlineSpace(b byte) bool {
+	return b == ' ' || b == '\n' || b == '\r' || b == '\t' || b == '\v' || b == '\f' || b == 0
+}
+
+func isHexDigit(b byte) bool {
+	return (b >= '0' && b <= '9') || (b >= 'a' && b <= 'f') || (b >= 'A' && b <= 'F')
+}
@@ -0,0 +1,197 @@
+package redisnats
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"hash/fnv"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/henomis/redis2nats/nats"
+)
+
+const (
+	optionScanMatch    Option = "MATCH"
+	optionScanCount    Option = "COUNT"
+	optionScanType     Option = "TYPE"
+	optionScanNoValues Option = "NOVALUES"
+
+	defaultScanCount = 10
+)
+
+// scanOptions are the options of the SCAN family of commands.
+type scanOptions struct {
+	pattern  string
+	count    int
+	keyType  string
+	noValues bool
+}
+
+// parseScanOptions parses the options following the cursor.
+// allowed lists the options supported by the command.
+func parseScanOptions(args []string, allowed ...Option) (scanOptions, error) {
+	options := scanOptions{
+		pattern: defaultKeysPattern,
+		count:   defaultScanCount,
+	}
+
+	for i := 0; i < len(args); i++ {
+		option := strings.ToUpper(args[i])
+		if !slices.Contains(allowed, option) {
+			return options, ErrSyntax
+		}
+
+		if option == optionScanNoValues {
+			options.noValues = true
+			continue
+		}
+
+		if i+1 >= len(args) {
+			return options, ErrSyntax
+		}
+		i++
+
+		switch option {
+		case optionScanMatch:
+			options.pattern = args[i]
+		case optionScanCount:
+			count, err := strconv.Atoi(args[i])
+			if err != nil {
+				return options, ErrNotInteger
+			}
+			if count < 1 {
+				return options, ErrSyntax
+			}
+			options.count = count
+		case optionScanType:
+			options.keyType = strings.ToLower(args[i])
+		}
+	}
+
+	return options, nil
+}
+
+// parseCursor parses a SCAN cursor.
+func parseCursor(cursor string) (uint64, error) {
+	value, err := strconv.ParseUint(cursor, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+
+	return value, nil
+}
+
+// fmtScan formats the reply of the SCAN family of commands: the next cursor and the elements.
+func fmtScan(cursor uint64, elements ...string) string {
+	encoded := make([]string, 0, len(elements))
+	for _, element := range elements {
+		encoded = append(encoded, fmtBulkString(element))
+	}
+
+	return fmtAggregate(
+		redisArrayPrefix, 2,
+		fmtBulkString(strconv.FormatUint(cursor, 10)),
+		fmtAggregate(redisArrayPrefix, len(encoded), encoded...),
+	)
+}
+
+// cmdScan iterates over the keys of the selected database.
+func (c *Command) cmdScan(ctx context.Context, args ...string) (string, error) {
+	if len(args) == 0 {
+		return redisNOP, ErrWrongNumArgs
+	}
+
+	cursor, err := parseCursor(args[0])
+	if err != nil {
+		return redisNOP, err
+	}
+
+	options, err := parseScanOptions(args[1:], optionScanMatch, optionScanCount, optionScanType)
+	if err != nil {
+		return redisNOP, err
+	}
+
+	keys, next, err := c.storage().Scan(ctx, cursor, options.pattern, options.count, options.keyType)
+	if err != nil {
+		return redisNOP, storageError(err)
+	}
+
+	return fmtScan(next, keys...), nil
+}
+
+// hashField is a field of a hash with its hash, which orders the fields in HSCAN.
+type hashField struct {
+	hash  uint64
+	field string
+}
+
+// fieldHash returns a stable 64-bit hash of the field name.
+func fieldHash(field string) uint64 {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(field))
+
+	return hash.Sum64()
+}
+
+// cmdHScan iterates over the fields of a hash.
+// The fields are ordered by the hash of their name and the cursor is the hash of the
+// next field to return, so fields added or removed between the calls do not make
+// HSCAN skip the others.
+func (c *Command) cmdHScan(ctx context.Context, args ...string) (string, error) {
+	if len(args) < 2 {
+		return redisNOP, ErrWrongNumArgs
+	}
+
+	key := args[0]
+
+	cursor, err := parseCursor(args[1])
+	if err != nil {
+		return redisNOP, err
+	}
+
+	options, err := parseScanOptions(args[2:], optionScanMatch, optionScanCount, optionScanNoValues)
+	if err != nil {
+		return redisNOP, err
+	}
+
+	hash, err := c.storage().HGetAll(ctx, key)
+	if err != nil && errors.Is(err, nats.ErrKeyNotFound) {
+		return fmtScan(0), nil
+	} else if err != nil {
+		return redisNOP, storageError(err)
+	}
+
+	fields := make([]hashField, 0, len(hash))
+	for field := range hash {
+		fields = append(fields, hashField{hash: fieldHash(field), field: field})
+	}
+	slices.SortFunc(fields, func(a, b hashField) int {
+		return cmp.Or(cmp.Compare(a.hash, b.hash), cmp.Compare(a.field, b.field))
+	})
+
+	start, _ := slices.BinarySearchFunc(fields, cursor, func(f hashField, cursor uint64) int {
+		return cmp.Compare(f.hash, cursor)
+	})
+	end := min(start+options.count, len(fields))
+
+	elements := make([]string, 0)
+	for _, f := range fields[start:end] {
+		if !nats.MatchPattern(f.field, options.pattern) {
+			continue
+		}
+
+		elements = append(elements, f.field)
+		if !options.noValues {
+			elements = append(elements, hash[f.field])
+		}
+	}
+
+	next := uint64(0)
+	if end < len(fields) {
+		next = fields[end].hash
+	}
+
+	return fmtScan(next, elements...), nil
+}
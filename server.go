@@ -2,6 +2,7 @@ package redisnats
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"log/slog"
 	"net"
@@ -12,16 +13,40 @@ import (
 
 const (
 	appName = "Redis2NATS"
+	// defaultPipelineMaxConcurrency is the default maximum number of pipelined
+	// read-only commands of a connection running at once.
+	defaultPipelineMaxConcurrency = 64
 )
 
 // Config represents the configuration for the fake Redis server.
 type Config struct {
-	NATSURL          string
-	NATSTimeout      time.Duration
-	NATSBucketPrefix string
-	NATSPersist      bool
-	RedisAddress     string
-	RedisNumDB       int
+	NATSURL                  string
+	NATSTimeout              time.Duration
+	NATSBucketPrefix         string
+	RedisAddress             string
+	RedisNumDB               int
+	RedisPipelineConcurrency bool
+	// RedisPipelineMaxConcurrency is the maximum number of pipelined read-only commands
+	// of a connection running at once, defaultPipelineMaxConcurrency when not positive.
+	RedisPipelineMaxConcurrency int
+	// RedisPassword is the password of the default user, empty if no password is required.
+	RedisPassword string
+	// RedisUsers are the ACL users, in ACL file format (user <username> <rules>...).
+	RedisUsers []string
+	// RedisTLS enables TLS on the Redis listener when not nil.
+	RedisTLS *TLSConfig
+	// NATSOptions are the NATS connection options (authentication, TLS, reconnection).
+	NATSOptions nats.Options
+	// NATSBucket is the configuration of the buckets of the databases.
+	NATSBucket nats.BucketConfig
+	// NATSDBBuckets overrides the configuration of the buckets of some databases, by database ID.
+	NATSDBBuckets map[int]nats.BucketConfig
+	// NATSStartupMode is what to do with the existing buckets at startup:
+	// keep (the default), flush-on-start or fail-if-exists.
+	NATSStartupMode string
+	// NATSKeyEncoding is how the keys are stored in the buckets:
+	// escape (the default), base64 or none.
+	NATSKeyEncoding string
 }
 
 // RedisServer represents the fake Redis server that uses a storage backend.
@@ -42,25 +67,105 @@ func NewRedisServer(c *Config) *RedisServer {
 
 // Start starts the fake Redis server on the given address.
 func (s *RedisServer) Start(ctx context.Context) error {
+	acl, err := newACL(s.config.RedisPassword, s.config.RedisUsers)
+	if err != nil {
+		return err
+	}
+
+	var tlsConfig *tls.Config
+	if s.config.RedisTLS != nil {
+		tlsConfig, err = s.config.RedisTLS.tlsConfig()
+		if err != nil {
+			return err
+		}
+	}
+
 	ln, err := net.Listen("tcp", s.config.RedisAddress)
 	if err != nil {
 		return err
 	}
+
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
 	defer ln.Close()
 
 	s.log.Info(fmt.Sprintf("%s server is running", appName), "address", s.config.RedisAddress)
 
-	// Create a storage pool with the number of databases specified in the configuration.
+	// Share one NATS connection among the databases, whose buckets are created on first use.
+	keyEncoding := nats.KeyEncoding(s.config.NATSKeyEncoding)
+	if keyEncoding == "" {
+		keyEncoding = nats.KeyEncodingEscape
+	}
+
+	manager := nats.NewManager(s.config.NATSURL, s.config.NATSOptions, keyEncoding)
+	err = manager.Connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer manager.Close()
+
+	// Instances sharing the buckets register themselves, so that a destructive
+	// startup mode does not remove the data other instances are serving.
+	err = manager.Register(ctx, s.config.NATSBucketPrefix+"-instances")
+	if err != nil {
+		return err
+	}
+
 	storagePool := make([]*nats.KV, s.config.RedisNumDB)
 	for i := 0; i < s.config.RedisNumDB; i++ {
-		bucket := fmt.Sprintf("%s-%d", s.config.NATSBucketPrefix, i)
-		storage := nats.New(s.config.NATSURL, bucket, s.config.NATSPersist)
-		errConnect := storage.Connect(ctx)
-		if errConnect != nil {
-			return errConnect
+		bucketConfig, ok := s.config.NATSDBBuckets[i]
+		if !ok {
+			bucketConfig = s.config.NATSBucket
 		}
-		storagePool[i] = storage
-		defer storage.Close()
+		storagePool[i] = manager.KV(fmt.Sprintf("%s-%d", s.config.NATSBucketPrefix, i), bucketConfig)
+	}
+
+	err = manager.Startup(ctx, s.config.NATSStartupMode, storagePool)
+	if err != nil {
+		return err
+	}
+
+	// The existing buckets of all the databases are checked now, not on first use
+	err = manager.Reconcile(ctx, storagePool)
+	if err != nil {
+		return err
+	}
+
+	// The mapping of the databases to the buckets is shared with the other instances
+	mapping, err := manager.OpenMapping(ctx, s.config.NATSBucketPrefix+"-databases", s.config.RedisNumDB)
+	if err != nil {
+		return err
+	}
+
+	if s.config.NATSStartupMode == nats.StartupModeFlushOnStart {
+		err = mapping.Reset(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	databases, err := newDatabases(ctx, storagePool, mapping)
+	if err != nil {
+		return err
+	}
+
+	err = databases.watch(ctx)
+	if err != nil {
+		return err
+	}
+
+	// The default database is used without SELECT.
+	if databases.count() > 0 {
+		err = databases.open(ctx, 0)
+		if err != nil {
+			return err
+		}
+	}
+
+	pipelineMaxConcurrency := s.config.RedisPipelineMaxConcurrency
+	if pipelineMaxConcurrency <= 0 {
+		pipelineMaxConcurrency = defaultPipelineMaxConcurrency
 	}
 
 	for {
@@ -79,7 +184,7 @@ func (s *RedisServer) Start(ctx context.Context) error {
 		}
 
 		// nolint:contextcheck
-		go NewConnection(conn, storagePool, s.config.NATSTimeout).handle()
+		go NewConnection(conn, databases, acl, s.config.RedisTLS, s.config.NATSTimeout, s.config.RedisPipelineConcurrency, pipelineMaxConcurrency).handle()
 	}
 }
 
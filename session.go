@@ -0,0 +1,38 @@
+package redisnats
+
+import (
+	"sync/atomic"
+
+	"github.com/henomis/redis2nats/nats"
+)
+
+// defaultUser is the user of the connections that did not authenticate,
+// unless it requires a password.
+const defaultUser = "default"
+
+// lastClientID is the last ID assigned to a client connection.
+var lastClientID atomic.Int64
+
+// session holds the state of a client connection.
+type session struct {
+	clientID   int64
+	clientName string
+	protocol   int
+	// dbID is the ID of the selected database.
+	dbID int
+	// user is the authenticated user, empty if the client did not authenticate.
+	user string
+	tx   *transaction
+	// watch holds the keys watched with WATCH, nil if there are none.
+	watch *nats.Watch
+	// watchSwaps is the number of SWAPDB run when the first key was watched.
+	watchSwaps uint64
+}
+
+func newSession(user string) *session {
+	return &session{
+		clientID: lastClientID.Add(1),
+		protocol: protocolRESP2,
+		user:     user,
+	}
+}
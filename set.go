@@ -0,0 +1,248 @@
+package redisnats
+
+import (
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/henomis/redis2nats/nats"
+)
+
+const (
+	optionSetNX      Option = "NX"
+	optionSetXX      Option = "XX"
+	optionSetGet     Option = "GET"
+	optionSetEX      Option = "EX"
+	optionSetPX      Option = "PX"
+	optionSetEXAT    Option = "EXAT"
+	optionSetPXAT    Option = "PXAT"
+	optionSetKeepTTL Option = "KEEPTTL"
+	optionGetPersist Option = "PERSIST"
+)
+
+// expireOptions are the options setting the expiration of a key.
+var expireOptions = []Option{optionSetEX, optionSetPX, optionSetEXAT, optionSetPXAT}
+
+// parseExpireTime parses the argument of an expire option of the command:
+// seconds (EX) or milliseconds (PX) from now, a Unix time in seconds (EXAT)
+// or in milliseconds (PXAT).
+func parseExpireTime(command string, option Option, arg string) (time.Time, error) {
+	value, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return time.Time{}, ErrNotInteger
+	}
+
+	if value <= 0 {
+		return time.Time{}, invalidExpireTimeError(command)
+	}
+
+	milliseconds := value
+	if option == optionSetEX || option == optionSetEXAT {
+		if value > math.MaxInt64/1000 {
+			return time.Time{}, invalidExpireTimeError(command)
+		}
+		milliseconds = value * 1000
+	}
+
+	if option == optionSetEX || option == optionSetPX {
+		now := time.Now().UnixMilli()
+		if milliseconds > math.MaxInt64-now {
+			return time.Time{}, invalidExpireTimeError(command)
+		}
+		milliseconds += now
+	}
+
+	return time.UnixMilli(milliseconds), nil
+}
+
+// parseSetOptions parses the options of SET following the key and the value.
+// All the options are checked before the key is written.
+func parseSetOptions(args []string) (nats.SetOptions, error) {
+	var options nats.SetOptions
+	var expireOption Option
+	var expireArg string
+
+	for i := 0; i < len(args); i++ {
+		option := strings.ToUpper(args[i])
+
+		switch {
+		case option == optionSetNX && !options.XX:
+			options.NX = true
+		case option == optionSetXX && !options.NX:
+			options.XX = true
+		case option == optionSetGet:
+			options.Get = true
+		case option == optionSetKeepTTL && expireOption == "":
+			options.KeepTTL = true
+		case slices.Contains(expireOptions, option) && expireOption == "" && !options.KeepTTL && i+1 < len(args):
+			expireOption, expireArg = option, args[i+1]
+			i++
+		default:
+			return options, ErrSyntax
+		}
+	}
+
+	if expireOption != "" {
+		expireAt, err := parseExpireTime("set", expireOption, expireArg)
+		if err != nil {
+			return options, err
+		}
+		options.ExpireAt = expireAt
+	}
+
+	return options, nil
+}
+
+// cmdSet stores the key-value pair using the provided storage.
+// syntax: SET key value [NX | XX] [GET] [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | KEEPTTL]
+func (c *Command) cmdSet(ctx context.Context, args ...string) (string, error) {
+	if len(args) < 2 {
+		return redisNOP, ErrWrongNumArgs
+	}
+
+	key, value := args[0], args[1]
+
+	options, err := parseSetOptions(args[2:])
+	if err != nil {
+		return redisNOP, err
+	}
+
+	previous, set, err := c.storage().SetWithOptions(ctx, key, []byte(value), options)
+	if err != nil {
+		return redisNOP, storageError(err)
+	}
+
+	if options.Get {
+		if previous == nil {
+			return c.reply().NullBulk(), nil
+		}
+		return c.reply().BulkString(string(previous)), nil
+	}
+
+	if !set {
+		return c.reply().NullBulk(), nil
+	}
+
+	return redisOK, nil
+}
+
+// cmdSetEX stores the key-value pair with a time to live in seconds.
+func (c *Command) cmdSetEX(ctx context.Context, args ...string) (string, error) {
+	return c.setWithExpiration(ctx, "setex", optionSetEX, args...)
+}
+
+// cmdPSetEX stores the key-value pair with a time to live in milliseconds.
+func (c *Command) cmdPSetEX(ctx context.Context, args ...string) (string, error) {
+	return c.setWithExpiration(ctx, "psetex", optionSetPX, args...)
+}
+
+// setWithExpiration stores the key-value pair with the expiration given as
+// the argument of the expire option.
+// syntax: key expiration value
+func (c *Command) setWithExpiration(ctx context.Context, command string, option Option, args ...string) (string, error) {
+	if len(args) != 3 {
+		return redisNOP, ErrWrongNumArgs
+	}
+
+	key, value := args[0], args[2]
+
+	expireAt, err := parseExpireTime(command, option, args[1])
+	if err != nil {
+		return redisNOP, err
+	}
+
+	_, _, err = c.storage().SetWithOptions(ctx, key, []byte(value), nats.SetOptions{ExpireAt: expireAt})
+	if err != nil {
+		return redisNOP, storageError(err)
+	}
+
+	return redisOK, nil
+}
+
+// cmdGetSet stores the value and returns the previous one.
+func (c *Command) cmdGetSet(ctx context.Context, args ...string) (string, error) {
+	if len(args) != 2 {
+		return redisNOP, ErrWrongNumArgs
+	}
+
+	key, value := args[0], args[1]
+
+	previous, _, err := c.storage().SetWithOptions(ctx, key, []byte(value), nats.SetOptions{Get: true})
+	if err != nil {
+		return redisNOP, storageError(err)
+	}
+
+	if previous == nil {
+		return c.reply().NullBulk(), nil
+	}
+
+	return c.reply().BulkString(string(previous)), nil
+}
+
+// cmdGetDel returns the value of the key and removes the key.
+func (c *Command) cmdGetDel(ctx context.Context, args ...string) (string, error) {
+	if len(args) != 1 {
+		return redisNOP, ErrWrongNumArgs
+	}
+
+	key := args[0]
+
+	value, err := c.storage().GetDel(ctx, key)
+	if err != nil && errors.Is(err, nats.ErrKeyNotFound) {
+		return c.reply().NullBulk(), nil
+	} else if err != nil {
+		return redisNOP, storageError(err)
+	}
+
+	return c.reply().BulkString(string(value)), nil
+}
+
+// cmdGetEX returns the value of the key and updates its expiration.
+// syntax: GETEX key [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | PERSIST]
+func (c *Command) cmdGetEX(ctx context.Context, args ...string) (string, error) {
+	if len(args) == 0 {
+		return redisNOP, ErrWrongNumArgs
+	}
+
+	key := args[0]
+
+	var expireAt time.Time
+	persist := false
+
+	switch {
+	case len(args) == 1:
+	case len(args) == 2 && strings.ToUpper(args[1]) == optionGetPersist:
+		persist = true
+	case len(args) == 3 && slices.Contains(expireOptions, strings.ToUpper(args[1])):
+		var err error
+		expireAt, err = parseExpireTime("getex", strings.ToUpper(args[1]), args[2])
+		if err != nil {
+			return redisNOP, err
+		}
+	default:
+		return redisNOP, ErrSyntax
+	}
+
+	value, err := c.storage().Get(ctx, key)
+	if err != nil && errors.Is(err, nats.ErrKeyNotFound) {
+		return c.reply().NullBulk(), nil
+	} else if err != nil {
+		return redisNOP, storageError(err)
+	}
+
+	switch {
+	case persist:
+		_, err = c.storage().Persist(ctx, key)
+	case !expireAt.IsZero():
+		err = c.storage().ExpireAt(ctx, key, expireAt)
+	}
+	if err != nil && !errors.Is(err, nats.ErrKeyNotFound) {
+		return redisNOP, storageError(err)
+	}
+
+	return c.reply().BulkString(string(value)), nil
+}
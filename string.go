@@ -0,0 +1,170 @@
+package redisnats
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/henomis/redis2nats/nats"
+)
+
+const (
+	optionLCSLen          Option = "LEN"
+	optionLCSIdx          Option = "IDX"
+	optionLCSMinMatchLen  Option = "MINMATCHLEN"
+	optionLCSWithMatchLen Option = "WITHMATCHLEN"
+)
+
+// cmdAppend appends the value to the string value of the key.
+func (c *Command) cmdAppend(ctx context.Context, args ...string) (string, error) {
+	if len(args) != 2 {
+		return redisNOP, ErrWrongNumArgs
+	}
+
+	key, value := args[0], args[1]
+
+	length, err := c.storage().Append(ctx, key, []byte(value))
+	if err != nil {
+		return redisNOP, storageError(err)
+	}
+
+	return c.reply().Integer(int64(length)), nil
+}
+
+// cmdStrLen returns the length of the string value of the key.
+func (c *Command) cmdStrLen(ctx context.Context, args ...string) (string, error) {
+	if len(args) != 1 {
+		return redisNOP, ErrWrongNumArgs
+	}
+
+	key := args[0]
+
+	length, err := c.storage().StrLen(ctx, key)
+	if err != nil {
+		return redisNOP, storageError(err)
+	}
+
+	return c.reply().Integer(int64(length)), nil
+}
+
+// cmdGetRange returns the substring of the string value of the key.
+// syntax: GETRANGE key start end
+func (c *Command) cmdGetRange(ctx context.Context, args ...string) (string, error) {
+	if len(args) != 3 {
+		return redisNOP, ErrWrongNumArgs
+	}
+
+	key := args[0]
+
+	start, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return redisNOP, ErrNotInteger
+	}
+
+	end, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return redisNOP, ErrNotInteger
+	}
+
+	value, err := c.storage().GetRange(ctx, key, start, end)
+	if err != nil {
+		return redisNOP, storageError(err)
+	}
+
+	return c.reply().BulkString(string(value)), nil
+}
+
+// cmdSetRange overwrites the string value of the key from the offset.
+// syntax: SETRANGE key offset value
+func (c *Command) cmdSetRange(ctx context.Context, args ...string) (string, error) {
+	if len(args) != 3 {
+		return redisNOP, ErrWrongNumArgs
+	}
+
+	key, value := args[0], args[2]
+
+	offset, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return redisNOP, ErrNotInteger
+	}
+
+	if offset < 0 {
+		return redisNOP, ErrOffsetOutOfRange
+	}
+
+	length, err := c.storage().SetRange(ctx, key, offset, []byte(value))
+	if err != nil {
+		return redisNOP, storageError(err)
+	}
+
+	return c.reply().Integer(int64(length)), nil
+}
+
+// cmdLCS returns the longest common subsequence of the string values of two keys.
+// syntax: LCS key1 key2 [LEN] [IDX] [MINMATCHLEN min-match-len] [WITHMATCHLEN]
+func (c *Command) cmdLCS(ctx context.Context, args ...string) (string, error) {
+	if len(args) < 2 {
+		return redisNOP, ErrWrongNumArgs
+	}
+
+	key1, key2 := args[0], args[1]
+
+	var getLen, getIdx, withMatchLen bool
+	minMatchLen := 0
+
+	for i := 2; i < len(args); i++ {
+		switch option := strings.ToUpper(args[i]); {
+		case option == optionLCSLen:
+			getLen = true
+		case option == optionLCSIdx:
+			getIdx = true
+		case option == optionLCSWithMatchLen:
+			withMatchLen = true
+		case option == optionLCSMinMatchLen && i+1 < len(args):
+			value, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return redisNOP, ErrNotInteger
+			}
+			minMatchLen = int(max(value, 0))
+			i++
+		default:
+			return redisNOP, ErrSyntax
+		}
+	}
+
+	if getLen && getIdx {
+		return redisNOP, ErrLCSLenAndIdx
+	}
+
+	lcs, matches, err := c.storage().LCS(ctx, key1, key2, minMatchLen)
+	if err != nil && errors.Is(err, nats.ErrWrongType) {
+		return redisNOP, ErrLCSWrongType
+	} else if err != nil {
+		return redisNOP, storageError(err)
+	}
+
+	switch {
+	case getIdx:
+		elements := make([]string, 0, len(matches))
+		for _, match := range matches {
+			element := []string{
+				c.reply().Array(c.reply().Integer(int64(match.Start1)), c.reply().Integer(int64(match.End1))),
+				c.reply().Array(c.reply().Integer(int64(match.Start2)), c.reply().Integer(int64(match.End2))),
+			}
+			if withMatchLen {
+				element = append(element, c.reply().Integer(int64(match.Length)))
+			}
+			elements = append(elements, c.reply().Array(element...))
+		}
+
+		return c.reply().Map(
+			c.reply().BulkString("matches"), c.reply().Array(elements...),
+			c.reply().BulkString("len"), c.reply().Integer(int64(len(lcs))),
+		), nil
+	case getLen:
+		return c.reply().Integer(int64(len(lcs))), nil
+	default:
+		return c.reply().BulkString(string(lcs)), nil
+	}
+}
@@ -1,14 +1,35 @@
 package tests
 
 import (
+	"bufio"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	redisnats "github.com/henomis/redis2nats"
+	"github.com/henomis/redis2nats/nats"
+	nc "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
 	"github.com/stretchr/testify/suite"
 	tc "github.com/testcontainers/testcontainers-go/modules/compose"
 )
@@ -49,7 +70,7 @@ func (suite *IntegrationTestSuite) SetupTest() {
 			NATSURL:          "nats://0.0.0.0:4222",
 			NATSTimeout:      10 * time.Second,
 			NATSBucketPrefix: "test",
-			NATSPersist:      false,
+			NATSStartupMode:  "flush-on-start",
 			RedisAddress:     ":6400",
 			RedisNumDB:       16,
 		},
@@ -203,6 +224,67 @@ func (suite *IntegrationTestSuite) TestSetEX() {
 	suite.Equal(setRedisResult, setRedis2natsResult)
 }
 
+func (suite *IntegrationTestSuite) TestSetOptions() {
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.T().Cleanup(cancel)
+
+	commands := [][]any{
+		{"SET", "key", "value", "PX", "5000"},
+		{"TTL", "key"},
+		{"SET", "key", "value"},
+		{"TTL", "key"},
+		{"SET", "key", "value", "EXAT", strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10)},
+		{"SET", "key", "value2", "KEEPTTL"},
+		{"TTL", "key"},
+		{"SET", "key", "value3", "PXAT", strconv.FormatInt(time.Now().Add(time.Minute).UnixMilli(), 10)},
+		{"TTL", "key"},
+		{"SET", "key", "value4", "GET"},
+		{"SET", "key", "value5", "NX", "GET"},
+		{"SET", "key2", "value", "NX", "GET"},
+		{"SET", "key3", "value", "XX"},
+		{"SET", "key", "value", "NX", "XX"},
+		{"SET", "key", "value", "EX", "10", "KEEPTTL"},
+		{"SET", "key", "value", "EX", "10", "PX", "1000"},
+		{"SET", "key", "value", "EX"},
+		{"SET", "key4", "value", "EX", "0"},
+		{"SET", "key4", "value", "EX", "abc"},
+		{"EXISTS", "key4"},
+		{"SET", "key4", "value", "EXAT", "1"},
+		{"EXISTS", "key4"},
+		{"HSET", "hash", "field", "value"},
+		{"SET", "hash", "value", "GET"},
+		{"SET", "hash", "value"},
+		{"GET", "hash"},
+		{"SETEX", "key", "10", "value"},
+		{"TTL", "key"},
+		{"SETEX", "key", "0", "value"},
+		{"PSETEX", "key", "10000", "value"},
+		{"TTL", "key"},
+		{"PSETEX", "key", "-1", "value"},
+		{"GETSET", "key", "value6"},
+		{"TTL", "key"},
+		{"GETSET", "key5", "value"},
+		{"GETEX", "key", "EX", "20"},
+		{"TTL", "key"},
+		{"GETEX", "key", "PERSIST"},
+		{"TTL", "key"},
+		{"GETEX", "key", "EX", "20", "PERSIST"},
+		{"GETEX", "missing", "EX", "20"},
+		{"GETDEL", "key"},
+		{"EXISTS", "key"},
+		{"GETDEL", "key"},
+		{"GETDEL", "hash"},
+	}
+
+	for _, command := range commands {
+		redisResult, redisErr := suite.redisClient.Do(ctx, command...).Result()
+		redis2natsResult, redis2natsErr := suite.redis2natsClient.Do(ctx, command...).Result()
+
+		suite.Equal(redisResult, redis2natsResult, command)
+		suite.Equal(fmt.Sprint(redisErr), fmt.Sprint(redis2natsErr), command)
+	}
+}
+
 func (suite *IntegrationTestSuite) TestTTL() {
 	ctx, cancel := context.WithCancel(context.Background())
 	suite.T().Cleanup(cancel)
@@ -325,6 +407,69 @@ func (suite *IntegrationTestSuite) TestGet() {
 	suite.Equal(getRedisResult, getRedis2natsResult)
 }
 
+func (suite *IntegrationTestSuite) TestGetBinary() {
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.T().Cleanup(cancel)
+
+	values := []string{"", " value ", "line1\r\nline2", "\x00\x01\xfe\xff"}
+
+	for _, value := range values {
+		// insert data
+		_, err := suite.redisClient.Set(ctx, "key", value, 0).Result()
+		suite.NoError(err)
+
+		_, err = suite.redis2natsClient.Set(ctx, "key", value, 0).Result()
+		suite.NoError(err)
+
+		// Test GET
+		getRedisResult, err := suite.redisClient.Get(ctx, "key").Result()
+		suite.NoError(err)
+
+		getRedis2natsResult, err := suite.redis2natsClient.Get(ctx, "key").Result()
+		suite.NoError(err)
+
+		suite.Equal(getRedisResult, getRedis2natsResult)
+		suite.Equal(value, getRedis2natsResult)
+	}
+}
+
+func (suite *IntegrationTestSuite) TestHashListBinary() {
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.T().Cleanup(cancel)
+
+	values := []string{"", " value ", "line1\r\nline2", "\x00\x01\xfe\xff", "\xc3\x28"}
+
+	for _, value := range values {
+		// Test HSET and HGET
+		for _, client := range []*redis.Client{suite.redisClient, suite.redis2natsClient} {
+			_, err := client.HSet(ctx, "hash", value, value).Result()
+			suite.NoError(err)
+
+			hgetResult, err := client.HGet(ctx, "hash", value).Result()
+			suite.NoError(err)
+			suite.Equal(value, hgetResult)
+		}
+
+		// Test LPUSH and LPOP
+		for _, client := range []*redis.Client{suite.redisClient, suite.redis2natsClient} {
+			_, err := client.LPush(ctx, "list", value, "last").Result()
+			suite.NoError(err)
+
+			lpopResult, err := client.LPopCount(ctx, "list", 2).Result()
+			suite.NoError(err)
+			suite.Equal([]string{"last", value}, lpopResult)
+		}
+	}
+
+	hgetallRedisResult, err := suite.redisClient.HGetAll(ctx, "hash").Result()
+	suite.NoError(err)
+
+	hgetallRedis2natsResult, err := suite.redis2natsClient.HGetAll(ctx, "hash").Result()
+	suite.NoError(err)
+
+	suite.Equal(hgetallRedisResult, hgetallRedis2natsResult)
+}
+
 func (suite *IntegrationTestSuite) TestKeys() {
 	ctx, cancel := context.WithCancel(context.Background())
 	suite.T().Cleanup(cancel)
@@ -452,6 +597,75 @@ func (suite *IntegrationTestSuite) TestIncr() {
 	suite.Equal(getRedisResult, getRedis2natsResult)
 }
 
+func (suite *IntegrationTestSuite) TestIncrMultipleInstances() {
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.T().Cleanup(cancel)
+
+	// Start a second instance sharing the same buckets
+	secondServer := redisnats.NewRedisServer(
+		&redisnats.Config{
+			NATSURL:          "nats://0.0.0.0:4222",
+			NATSTimeout:      10 * time.Second,
+			NATSBucketPrefix: "test",
+			NATSStartupMode:  "keep",
+			RedisAddress:     ":6401",
+			RedisNumDB:       16,
+		},
+	)
+
+	go func() {
+		err := secondServer.Start(ctx)
+		if err != nil {
+			suite.T().Log(err)
+		}
+	}()
+
+	suite.T().Cleanup(func() {
+		secondServer.Stop()
+	})
+
+	secondClient := redis.NewClient(&redis.Options{
+		Addr: "0.0.0.0:6401",
+		DB:   0,
+	})
+
+	suite.T().Cleanup(func() {
+		secondClient.Close()
+	})
+
+	suite.Eventually(func() bool {
+		return secondClient.Ping(ctx).Err() == nil
+	}, 10*time.Second, 100*time.Millisecond)
+
+	// insert data
+	_, err := suite.redis2natsClient.Set(ctx, "key", "0", 0).Result()
+	suite.NoError(err)
+
+	var wg sync.WaitGroup
+	iterations := 500
+
+	for i := 0; i < iterations; i++ {
+		for _, client := range []*redis.Client{suite.redis2natsClient, secondClient} {
+			wg.Add(1)
+
+			go func(client *redis.Client) {
+				defer wg.Done()
+				// Test INCR
+				_, errIncr := client.Incr(ctx, "key").Result()
+				suite.NoError(errIncr)
+			}(client)
+		}
+	}
+
+	wg.Wait()
+
+	// get value
+	getRedis2natsResult, err := suite.redis2natsClient.Get(ctx, "key").Result()
+	suite.NoError(err)
+
+	suite.Equal(fmt.Sprintf("%d", 2*iterations), getRedis2natsResult)
+}
+
 func (suite *IntegrationTestSuite) TestDecr() {
 	ctx, cancel := context.WithCancel(context.Background())
 	suite.T().Cleanup(cancel)
@@ -502,6 +716,187 @@ func (suite *IntegrationTestSuite) TestDecr() {
 	suite.Equal(getRedisResult, getRedis2natsResult)
 }
 
+func (suite *IntegrationTestSuite) TestIncrBy() {
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.T().Cleanup(cancel)
+
+	commands := [][]any{
+		{"INCRBY", "key", "10"},
+		{"INCRBY", "key", "-25"},
+		{"DECRBY", "key", "5"},
+		{"DECRBY", "key", "-3000000000"},
+		{"INCRBY", "key", "abc"},
+		{"INCRBY", "key", "9223372036854775808"},
+		{"DECRBY", "key", "-9223372036854775808"},
+		{"SET", "max", "9223372036854775807"},
+		{"INCRBY", "max", "1"},
+		{"INCR", "max"},
+		{"DECRBY", "max", "-1"},
+		{"SET", "min", "-9223372036854775808"},
+		{"DECRBY", "min", "1"},
+		{"DECR", "min"},
+		{"INCRBY", "min", "-1"},
+		{"SET", "big", "9223372036854775808"},
+		{"INCRBY", "big", "1"},
+		{"SET", "text", "value"},
+		{"INCRBY", "text", "1"},
+		{"HSET", "hash", "field", "value"},
+		{"INCRBY", "hash", "1"},
+		{"DECRBY", "hash", "1"},
+		{"GET", "key"},
+	}
+
+	for _, command := range commands {
+		redisResult, redisErr := suite.redisClient.Do(ctx, command...).Result()
+		redis2natsResult, redis2natsErr := suite.redis2natsClient.Do(ctx, command...).Result()
+
+		suite.Equal(redisResult, redis2natsResult, command)
+		suite.Equal(fmt.Sprint(redisErr), fmt.Sprint(redis2natsErr), command)
+	}
+}
+
+func (suite *IntegrationTestSuite) TestIncrByFloat() {
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.T().Cleanup(cancel)
+
+	commands := [][]any{
+		{"INCRBYFLOAT", "key", "10.5"},
+		{"INCRBYFLOAT", "key", "0.1"},
+		{"INCRBYFLOAT", "key", "-5"},
+		{"INCRBYFLOAT", "key", "5.0e3"},
+		{"INCRBYFLOAT", "key", "-5005.6"},
+		{"INCRBYFLOAT", "key", "abc"},
+		{"INCRBYFLOAT", "key", "inf"},
+		{"INCRBYFLOAT", "key", "nan"},
+		{"INCRBYFLOAT", "key", " 1"},
+		{"SET", "int", "3"},
+		{"INCRBYFLOAT", "int", "1.5"},
+		{"INCRBYFLOAT", "int", "-4.5"},
+		{"SET", "text", "value"},
+		{"INCRBYFLOAT", "text", "1"},
+		{"HSET", "hash", "field", "value"},
+		{"INCRBYFLOAT", "hash", "1"},
+		{"GET", "key"},
+	}
+
+	for _, command := range commands {
+		redisResult, redisErr := suite.redisClient.Do(ctx, command...).Result()
+		redis2natsResult, redis2natsErr := suite.redis2natsClient.Do(ctx, command...).Result()
+
+		suite.Equal(redisResult, redis2natsResult, command)
+		suite.Equal(fmt.Sprint(redisErr), fmt.Sprint(redis2natsErr), command)
+	}
+}
+
+func (suite *IntegrationTestSuite) TestStringRange() {
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.T().Cleanup(cancel)
+
+	commands := [][]any{
+		{"APPEND", "key", "Hello"},
+		{"APPEND", "key", " World"},
+		{"STRLEN", "key"},
+		{"STRLEN", "missing"},
+		{"GETRANGE", "key", "0", "4"},
+		{"GETRANGE", "key", "-5", "-1"},
+		{"GETRANGE", "key", "-1", "-5"},
+		{"GETRANGE", "key", "5", "2"},
+		{"GETRANGE", "key", "0", "100"},
+		{"GETRANGE", "key", "-100", "2"},
+		{"GETRANGE", "key", "a", "2"},
+		{"GETRANGE", "missing", "0", "-1"},
+		{"SUBSTR", "key", "6", "-1"},
+		{"SETRANGE", "key", "6", "Redis"},
+		{"GET", "key"},
+		{"SETRANGE", "padded", "5", "value"},
+		{"GET", "padded"},
+		{"SETRANGE", "key", "20", ""},
+		{"SETRANGE", "missing", "20", ""},
+		{"EXISTS", "missing"},
+		{"SETRANGE", "key", "-1", "value"},
+		{"SETRANGE", "key", "536870912", "value"},
+		{"SETRANGE", "key", "a", "value"},
+		{"HSET", "hash", "field", "value"},
+		{"APPEND", "hash", "value"},
+		{"STRLEN", "hash"},
+		{"GETRANGE", "hash", "0", "-1"},
+		{"SETRANGE", "hash", "0", "value"},
+		{"SETRANGE", "hash", "0", ""},
+	}
+
+	for _, command := range commands {
+		redisResult, redisErr := suite.redisClient.Do(ctx, command...).Result()
+		redis2natsResult, redis2natsErr := suite.redis2natsClient.Do(ctx, command...).Result()
+
+		suite.Equal(redisResult, redis2natsResult, command)
+		suite.Equal(fmt.Sprint(redisErr), fmt.Sprint(redis2natsErr), command)
+	}
+}
+
+func (suite *IntegrationTestSuite) TestLCS() {
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.T().Cleanup(cancel)
+
+	commands := [][]any{
+		{"MSET", "key1", "ohmytext", "key2", "mynewtext"},
+		{"LCS", "key1", "key2"},
+		{"LCS", "key1", "key2", "LEN"},
+		{"LCS", "key1", "key2", "IDX"},
+		{"LCS", "key1", "key2", "IDX", "MINMATCHLEN", "4"},
+		{"LCS", "key1", "key2", "IDX", "MINMATCHLEN", "4", "WITHMATCHLEN"},
+		{"LCS", "key1", "key2", "IDX", "MINMATCHLEN", "-1", "WITHMATCHLEN"},
+		{"LCS", "key1", "missing"},
+		{"LCS", "key1", "missing", "IDX"},
+		{"LCS", "key1", "key2", "LEN", "IDX"},
+		{"LCS", "key1", "key2", "MINMATCHLEN"},
+		{"LCS", "key1", "key2", "MINMATCHLEN", "a"},
+		{"LCS", "key1", "key2", "INVALID"},
+		{"HSET", "hash", "field", "value"},
+		{"LCS", "key1", "hash"},
+	}
+
+	for _, command := range commands {
+		redisResult, redisErr := suite.redisClient.Do(ctx, command...).Result()
+		redis2natsResult, redis2natsErr := suite.redis2natsClient.Do(ctx, command...).Result()
+
+		suite.Equal(redisResult, redis2natsResult, command)
+		suite.Equal(fmt.Sprint(redisErr), fmt.Sprint(redis2natsErr), command)
+	}
+}
+
+func (suite *IntegrationTestSuite) TestConcurrentMultiKey() {
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.T().Cleanup(cancel)
+
+	var wg sync.WaitGroup
+	iterations := 200
+
+	// Multi-key commands on overlapping keys, in different orders
+	for i := 0; i < iterations; i++ {
+		wg.Add(2)
+
+		go func() {
+			defer wg.Done()
+			errSet := suite.redis2natsClient.MSet(ctx, "a", "1", "b", "2", "c", "3").Err()
+			suite.NoError(errSet)
+		}()
+
+		go func() {
+			defer wg.Done()
+			errSet := suite.redis2natsClient.MSet(ctx, "c", "3", "b", "2", "a", "1").Err()
+			suite.NoError(errSet)
+		}()
+	}
+
+	wg.Wait()
+
+	// get values
+	mgetRedis2natsResult, err := suite.redis2natsClient.MGet(ctx, "a", "b", "c").Result()
+	suite.NoError(err)
+
+	suite.Equal([]interface{}{"1", "2", "3"}, mgetRedis2natsResult)
+}
+
 func (suite *IntegrationTestSuite) TestExists() {
 	ctx, cancel := context.WithCancel(context.Background())
 	suite.T().Cleanup(cancel)
@@ -889,51 +1284,1781 @@ func (suite *IntegrationTestSuite) TestLRange() {
 	suite.Equal(lrangeRedisResult, lrangeRedis2natsResult)
 }
 
-func (suite *IntegrationTestSuite) TestSelect() {
+func (suite *IntegrationTestSuite) TestType() {
 	ctx, cancel := context.WithCancel(context.Background())
 	suite.T().Cleanup(cancel)
 
-	// Test SELECT
-	selectRedisResult, err := suite.redisClient.Do(ctx, "SELECT", 1).Result()
+	for _, client := range []*redis.Client{suite.redisClient, suite.redis2natsClient} {
+		_, err := client.Set(ctx, "string", "value", 0).Result()
+		suite.NoError(err)
+
+		_, err = client.HSet(ctx, "hash", "field", "value").Result()
+		suite.NoError(err)
+
+		_, err = client.LPush(ctx, "list", "value").Result()
+		suite.NoError(err)
+	}
+
+	// Test TYPE
+	for _, key := range []string{"string", "hash", "list", "missing"} {
+		typeRedisResult, err := suite.redisClient.Type(ctx, key).Result()
+		suite.NoError(err)
+
+		typeRedis2natsResult, err := suite.redis2natsClient.Type(ctx, key).Result()
+		suite.NoError(err)
+
+		suite.Equal(typeRedisResult, typeRedis2natsResult, key)
+	}
+
+	// Test WRONGTYPE
+	commands := [][]interface{}{
+		{"GET", "hash"},
+		{"INCR", "list"},
+		{"HGET", "string", "field"},
+		{"HSET", "list", "field", "value"},
+		{"HGETALL", "string"},
+		{"LPUSH", "hash", "value"},
+		{"LRANGE", "string", 0, -1},
+	}
+
+	for _, command := range commands {
+		_, errRedis := suite.redisClient.Do(ctx, command...).Result()
+		suite.Error(errRedis)
+
+		_, errRedis2nats := suite.redis2natsClient.Do(ctx, command...).Result()
+		suite.Error(errRedis2nats)
+
+		suite.Equal(errRedis.Error(), errRedis2nats.Error(), command[0])
+	}
+
+	// Test MGET
+	mgetRedisResult, err := suite.redisClient.MGet(ctx, "string", "hash", "list").Result()
 	suite.NoError(err)
 
-	selectRedis2natsResult, err := suite.redis2natsClient.Do(ctx, "SELECT", 1).Result()
+	mgetRedis2natsResult, err := suite.redis2natsClient.MGet(ctx, "string", "hash", "list").Result()
 	suite.NoError(err)
 
-	suite.Equal(selectRedisResult, selectRedis2natsResult)
+	suite.Equal(mgetRedisResult, mgetRedis2natsResult)
 
-	// Test SELECT
-	selectRedisResult, err = suite.redisClient.Do(ctx, "SELECT", 17).Result()
-	suite.Error(err)
+	// Test SET overwrites the type
+	for _, client := range []*redis.Client{suite.redisClient, suite.redis2natsClient} {
+		_, err = client.Set(ctx, "hash", "value", 0).Result()
+		suite.NoError(err)
+	}
 
-	selectRedis2natsResult, err = suite.redis2natsClient.Do(ctx, "SELECT", 17).Result()
-	suite.Error(err)
+	typeRedisResult, err := suite.redisClient.Type(ctx, "hash").Result()
+	suite.NoError(err)
 
-	suite.Equal(selectRedisResult, selectRedis2natsResult)
+	typeRedis2natsResult, err := suite.redis2natsClient.Type(ctx, "hash").Result()
+	suite.NoError(err)
+
+	suite.Equal(typeRedisResult, typeRedis2natsResult)
 }
 
-func (suite *IntegrationTestSuite) TestNotSupported() {
+func (suite *IntegrationTestSuite) TestEmptyHashList() {
 	ctx, cancel := context.WithCancel(context.Background())
 	suite.T().Cleanup(cancel)
 
-	// Test unsupported command
-	_, err := suite.redisClient.Do(ctx, "NOTSUPPORTED").Result()
-	suite.Error(err)
+	for _, client := range []*redis.Client{suite.redisClient, suite.redis2natsClient} {
+		_, err := client.HSet(ctx, "hash", "field1", "value", "field2", "value").Result()
+		suite.NoError(err)
 
-	_, err = suite.redis2natsClient.Do(ctx, "NOTSUPPORTED").Result()
-	suite.Error(err)
+		_, err = client.LPush(ctx, "list", "value1", "value2").Result()
+		suite.NoError(err)
+
+		_, err = client.Expire(ctx, "list", time.Minute).Result()
+		suite.NoError(err)
+
+		// Removing the last field and the last element removes the key
+		_, err = client.HDel(ctx, "hash", "field1", "field2").Result()
+		suite.NoError(err)
+
+		_, err = client.LPopCount(ctx, "list", 2).Result()
+		suite.NoError(err)
+	}
+
+	commands := [][]interface{}{
+		{"TYPE", "hash"},
+		{"TYPE", "list"},
+		{"EXISTS", "hash", "list"},
+		{"DBSIZE"},
+		{"HDEL", "hash", "field1"},
+		{"LPOP", "list"},
+		{"LPUSH", "list", "value"},
+		{"TTL", "list"},
+	}
+
+	for _, command := range commands {
+		redisResult, redisErr := suite.redisClient.Do(ctx, command...).Result()
+		redis2natsResult, redis2natsErr := suite.redis2natsClient.Do(ctx, command...).Result()
+
+		suite.Equal(redisResult, redis2natsResult, command)
+		suite.Equal(fmt.Sprint(redisErr), fmt.Sprint(redis2natsErr), command)
+	}
 }
 
-func (suite *IntegrationTestSuite) TestInvalidCommand() {
+func (suite *IntegrationTestSuite) TestLegacyValues() {
 	ctx, cancel := context.WithCancel(context.Background())
 	suite.T().Cleanup(cancel)
 
-	// Test unsupported command
-	_, err := suite.redisClient.Do(ctx, "GET", "KEY", "OTHER", "COMMAND").Result()
+	// Values written by earlier versions have no type envelope
+	conn, err := nc.Connect("nats://0.0.0.0:4222")
+	suite.NoError(err)
+	suite.T().Cleanup(conn.Close)
+
+	js, err := jetstream.New(conn)
+	suite.NoError(err)
+
+	store, err := js.KeyValue(ctx, "test-0")
+	suite.NoError(err)
+
+	_, err = store.Put(ctx, "cached", []byte(`{"field":"value"}`))
+	suite.NoError(err)
+
+	_, err = store.Put(ctx, "list", []byte(`["value"]`))
+	suite.NoError(err)
+
+	// Hashes and lists written by earlier versions have a JSON payload
+	_, err = store.Put(ctx, "hash", []byte("\x00h"+`{"field":"value"}`))
+	suite.NoError(err)
+
+	// Test GET
+	getResult, err := suite.redis2natsClient.Get(ctx, "cached").Result()
+	suite.NoError(err)
+	suite.Equal(`{"field":"value"}`, getResult)
+
+	typeResult, err := suite.redis2natsClient.Type(ctx, "cached").Result()
+	suite.NoError(err)
+	suite.Equal("string", typeResult)
+
+	// Test HGET
+	hgetResult, err := suite.redis2natsClient.HGet(ctx, "cached", "field").Result()
+	suite.NoError(err)
+	suite.Equal("value", hgetResult)
+
+	// Test LRANGE
+	lrangeResult, err := suite.redis2natsClient.LRange(ctx, "list", 0, -1).Result()
+	suite.NoError(err)
+	suite.Equal([]string{"value"}, lrangeResult)
+
+	// Test HGET and HSET on a JSON payload
+	hgetResult, err = suite.redis2natsClient.HGet(ctx, "hash", "field").Result()
+	suite.NoError(err)
+	suite.Equal("value", hgetResult)
+
+	_, err = suite.redis2natsClient.HSet(ctx, "hash", "other", "\xff").Result()
+	suite.NoError(err)
+
+	hgetallResult, err := suite.redis2natsClient.HGetAll(ctx, "hash").Result()
+	suite.NoError(err)
+	suite.Equal(map[string]string{"field": "value", "other": "\xff"}, hgetallResult)
+
+	// Test JSON payloads of another type and corrupted payloads
+	_, err = store.Put(ctx, "numbers", []byte(`{"field":1}`))
+	suite.NoError(err)
+
+	_, err = store.Put(ctx, "corrupted", []byte("\x00h\x00\x05ab"))
+	suite.NoError(err)
+
+	_, err = suite.redis2natsClient.HGet(ctx, "numbers", "field").Result()
+	suite.EqualError(err, "WRONGTYPE Operation against a key holding the wrong kind of value")
+
+	_, err = suite.redis2natsClient.HGet(ctx, "corrupted", "field").Result()
+	suite.EqualError(err, "ERR the value stored at the key is not a valid hash or list")
+}
+
+func (suite *IntegrationTestSuite) TestPipeline() {
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.T().Cleanup(cancel)
+
+	redisPipe := suite.redisClient.Pipeline()
+	redis2natsPipe := suite.redis2natsClient.Pipeline()
+
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i)
+
+		for _, pipe := range []redis.Pipeliner{redisPipe, redis2natsPipe} {
+			pipe.Set(ctx, key, i, 0)
+			pipe.Get(ctx, key)
+			pipe.MGet(ctx, key, "missing")
+			pipe.Exists(ctx, key, "missing")
+			pipe.Incr(ctx, key)
+		}
+	}
+
+	// Test pipelined commands
+	redisCmds, err := redisPipe.Exec(ctx)
+	suite.NoError(err)
+
+	redis2natsCmds, err := redis2natsPipe.Exec(ctx)
+	suite.NoError(err)
+
+	suite.Equal(len(redisCmds), len(redis2natsCmds))
+
+	for i := range redisCmds {
+		suite.Equal(redisCmds[i].String(), redis2natsCmds[i].String())
+	}
+}
+
+func (suite *IntegrationTestSuite) TestMultiExec() {
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.T().Cleanup(cancel)
+
+	txFn := func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, "key", "value", 0)
+		pipe.Incr(ctx, "counter")
+		pipe.Get(ctx, "key")
+		pipe.HSet(ctx, "hash", "field", "value")
+		// INCR on a non-integer value fails at runtime without aborting the transaction
+		pipe.Incr(ctx, "key")
+		return nil
+	}
+
+	// Test MULTI/EXEC
+	redisCmds, err := suite.redisClient.TxPipelined(ctx, txFn)
 	suite.Error(err)
 
-	_, err = suite.redis2natsClient.Do(ctx, "GET", "KEY", "OTHER", "COMMAND").Result()
+	redis2natsCmds, err := suite.redis2natsClient.TxPipelined(ctx, txFn)
 	suite.Error(err)
+
+	suite.Equal(len(redisCmds), len(redis2natsCmds))
+
+	for i := 0; i < len(redisCmds)-1; i++ {
+		suite.Equal(redisCmds[i].String(), redis2natsCmds[i].String())
+	}
+
+	// Test EXECABORT on queuing errors
+	abortFn := func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, "key", "value1", 0)
+		pipe.Do(ctx, "GET")
+		return nil
+	}
+
+	_, err = suite.redisClient.TxPipelined(ctx, abortFn)
+	suite.Error(err)
+
+	_, err = suite.redis2natsClient.TxPipelined(ctx, abortFn)
+	suite.Error(err)
+
+	// Test DISCARD
+	getRedisResult, err := suite.redisClient.Get(ctx, "key").Result()
+	suite.NoError(err)
+
+	getRedis2natsResult, err := suite.redis2natsClient.Get(ctx, "key").Result()
+	suite.NoError(err)
+
+	suite.Equal(getRedisResult, getRedis2natsResult)
+
+	_, err = suite.redisClient.Do(ctx, "DISCARD").Result()
+	suite.Error(err)
+
+	_, errRedis2nats := suite.redis2natsClient.Do(ctx, "DISCARD").Result()
+	suite.Error(errRedis2nats)
+
+	suite.Equal(err.Error(), errRedis2nats.Error())
+}
+
+func (suite *IntegrationTestSuite) TestWatch() {
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.T().Cleanup(cancel)
+
+	checkAndSet := func(client *redis.Client, modify bool) error {
+		return client.Watch(ctx, func(tx *redis.Tx) error {
+			value, err := tx.Get(ctx, "leader").Result()
+			if err != nil && err != redis.Nil {
+				return err
+			}
+
+			if modify {
+				// Another client changes the watched key before EXEC
+				errSet := client.Set(ctx, "leader", "other", 0).Err()
+				if errSet != nil {
+					return errSet
+				}
+			}
+
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Set(ctx, "leader", value+"me", 0)
+				return nil
+			})
+			return err
+		}, "leader")
+	}
+
+	// Test WATCH with unmodified key
+	errRedis := checkAndSet(suite.redisClient, false)
+	suite.NoError(errRedis)
+
+	errRedis2nats := checkAndSet(suite.redis2natsClient, false)
+	suite.NoError(errRedis2nats)
+
+	// Test WATCH with modified key
+	errRedis = checkAndSet(suite.redisClient, true)
+	suite.ErrorIs(errRedis, redis.TxFailedErr)
+
+	errRedis2nats = checkAndSet(suite.redis2natsClient, true)
+	suite.ErrorIs(errRedis2nats, redis.TxFailedErr)
+
+	getRedisResult, err := suite.redisClient.Get(ctx, "leader").Result()
+	suite.NoError(err)
+
+	getRedis2natsResult, err := suite.redis2natsClient.Get(ctx, "leader").Result()
+	suite.NoError(err)
+
+	suite.Equal(getRedisResult, getRedis2natsResult)
+
+	// Test WATCH with key modified by another instance: no queued command is applied
+	conn, err := nc.Connect("nats://0.0.0.0:4222")
+	suite.NoError(err)
+	suite.T().Cleanup(conn.Close)
+
+	js, err := jetstream.New(conn)
+	suite.NoError(err)
+
+	store, err := js.KeyValue(ctx, "test-0")
+	suite.NoError(err)
+
+	err = suite.redis2natsClient.Watch(ctx, func(tx *redis.Tx) error {
+		_, errPut := store.Put(ctx, "leader", []byte("\x00sremote"))
+		if errPut != nil {
+			return errPut
+		}
+
+		_, errTx := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, "follower", "me", 0)
+			pipe.Set(ctx, "leader", "me", 0)
+			return nil
+		})
+		return errTx
+	}, "leader")
+	suite.ErrorIs(err, redis.TxFailedErr)
+
+	getResult, err := suite.redis2natsClient.Get(ctx, "leader").Result()
+	suite.NoError(err)
+	suite.Equal("remote", getResult)
+
+	existsResult, err := suite.redis2natsClient.Exists(ctx, "follower").Result()
+	suite.NoError(err)
+	suite.Equal(int64(0), existsResult)
+
+	// Test UNWATCH
+	unwatchRedisResult, err := suite.redisClient.Do(ctx, "UNWATCH").Result()
+	suite.NoError(err)
+
+	unwatchRedis2natsResult, err := suite.redis2natsClient.Do(ctx, "UNWATCH").Result()
+	suite.NoError(err)
+
+	suite.Equal(unwatchRedisResult, unwatchRedis2natsResult)
+}
+
+func (suite *IntegrationTestSuite) TestSelect() {
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.T().Cleanup(cancel)
+
+	// Test SELECT
+	selectRedisResult, err := suite.redisClient.Do(ctx, "SELECT", 1).Result()
+	suite.NoError(err)
+
+	selectRedis2natsResult, err := suite.redis2natsClient.Do(ctx, "SELECT", 1).Result()
+	suite.NoError(err)
+
+	suite.Equal(selectRedisResult, selectRedis2natsResult)
+
+	// Test SELECT
+	selectRedisResult, err = suite.redisClient.Do(ctx, "SELECT", 17).Result()
+	suite.Error(err)
+
+	selectRedis2natsResult, err = suite.redis2natsClient.Do(ctx, "SELECT", 17).Result()
+	suite.Error(err)
+
+	suite.Equal(selectRedisResult, selectRedis2natsResult)
+}
+
+func (suite *IntegrationTestSuite) TestFlush() {
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.T().Cleanup(cancel)
+
+	for _, client := range []*redis.Client{suite.redisClient, suite.redis2natsClient} {
+		_, err := client.Set(ctx, "key", "value", 0).Result()
+		suite.NoError(err)
+
+		_, err = client.Expire(ctx, "key", 100*time.Second).Result()
+		suite.NoError(err)
+
+		_, err = client.Do(ctx, "MOVE", "key", 1).Result()
+		suite.NoError(err)
+
+		_, err = client.Set(ctx, "key", "value", 0).Result()
+		suite.NoError(err)
+	}
+
+	// Test FLUSHDB
+	flushDBRedisResult, err := suite.redisClient.FlushDB(ctx).Result()
+	suite.NoError(err)
+
+	flushDBRedis2natsResult, err := suite.redis2natsClient.FlushDB(ctx).Result()
+	suite.NoError(err)
+
+	suite.Equal(flushDBRedisResult, flushDBRedis2natsResult)
+
+	existsRedisResult, err := suite.redisClient.Exists(ctx, "key").Result()
+	suite.NoError(err)
+
+	existsRedis2natsResult, err := suite.redis2natsClient.Exists(ctx, "key").Result()
+	suite.NoError(err)
+
+	suite.Equal(existsRedisResult, existsRedis2natsResult)
+
+	// Test FLUSHALL
+	flushAllRedisResult, err := suite.redisClient.FlushAll(ctx).Result()
+	suite.NoError(err)
+
+	flushAllRedis2natsResult, err := suite.redis2natsClient.FlushAll(ctx).Result()
+	suite.NoError(err)
+
+	suite.Equal(flushAllRedisResult, flushAllRedis2natsResult)
+
+	for _, client := range []*redis.Client{suite.redisClient, suite.redis2natsClient} {
+		_, err = client.Do(ctx, "SELECT", 1).Result()
+		suite.NoError(err)
+
+		exists, errExists := client.Exists(ctx, "key").Result()
+		suite.NoError(errExists)
+		suite.Equal(int64(0), exists)
+
+		_, err = client.Set(ctx, "key", "value", 0).Result()
+		suite.NoError(err)
+
+		ttl, errTTL := client.TTL(ctx, "key").Result()
+		suite.NoError(errTTL)
+		suite.Equal(time.Duration(-1), ttl)
+	}
+}
+
+func (suite *IntegrationTestSuite) TestScan() {
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.T().Cleanup(cancel)
+
+	for _, client := range []*redis.Client{suite.redisClient, suite.redis2natsClient} {
+		for i := 0; i < 25; i++ {
+			_, err := client.Set(ctx, fmt.Sprintf("key:%d", i), "value", 0).Result()
+			suite.NoError(err)
+		}
+
+		for i := 0; i < 30; i++ {
+			_, err := client.HSet(ctx, "hash", fmt.Sprintf("field:%d", i), i).Result()
+			suite.NoError(err)
+		}
+
+		_, err := client.Set(ctx, "other", "value", 0).Result()
+		suite.NoError(err)
+	}
+
+	scanKeys := func(client *redis.Client, match string, keyType string) []string {
+		keys := []string{}
+		var iterator *redis.ScanIterator
+		if keyType != "" {
+			iterator = client.ScanType(ctx, 0, match, 5, keyType).Iterator()
+		} else {
+			iterator = client.Scan(ctx, 0, match, 5).Iterator()
+		}
+
+		for iterator.Next(ctx) {
+			if !slices.Contains(keys, iterator.Val()) {
+				keys = append(keys, iterator.Val())
+			}
+		}
+		suite.NoError(iterator.Err())
+
+		slices.Sort(keys)
+		return keys
+	}
+
+	// Test SCAN
+	suite.Len(scanKeys(suite.redis2natsClient, "*", ""), 27)
+	suite.Equal(scanKeys(suite.redisClient, "*", ""), scanKeys(suite.redis2natsClient, "*", ""))
+
+	// Test SCAN MATCH
+	suite.Equal(scanKeys(suite.redisClient, "key:*", ""), scanKeys(suite.redis2natsClient, "key:*", ""))
+
+	// Test SCAN TYPE
+	suite.Equal(scanKeys(suite.redisClient, "*", "hash"), scanKeys(suite.redis2natsClient, "*", "hash"))
+
+	// Test SCAN with an invalid cursor
+	_, err := suite.redisClient.Do(ctx, "SCAN", "invalid").Result()
+	suite.Error(err)
+
+	_, err = suite.redis2natsClient.Do(ctx, "SCAN", "invalid").Result()
+	suite.Error(err)
+
+	// Test HSCAN
+	hscanFields := func(client *redis.Client, match string) map[string]string {
+		fields := map[string]string{}
+		iterator := client.HScan(ctx, "hash", 0, match, 7).Iterator()
+		for iterator.Next(ctx) {
+			field := iterator.Val()
+			suite.True(iterator.Next(ctx))
+			fields[field] = iterator.Val()
+		}
+		suite.NoError(iterator.Err())
+
+		return fields
+	}
+
+	suite.Equal(hscanFields(suite.redisClient, "*"), hscanFields(suite.redis2natsClient, "*"))
+	suite.Equal(hscanFields(suite.redisClient, "field:1*"), hscanFields(suite.redis2natsClient, "field:1*"))
+
+	// Test HSCAN on a missing key
+	hscanRedisKeys, hscanRedisCursor, err := suite.redisClient.HScan(ctx, "missing", 0, "*", 10).Result()
+	suite.NoError(err)
+
+	hscanRedis2natsKeys, hscanRedis2natsCursor, err := suite.redis2natsClient.HScan(ctx, "missing", 0, "*", 10).Result()
+	suite.NoError(err)
+
+	suite.Equal(hscanRedisKeys, hscanRedis2natsKeys)
+	suite.Equal(hscanRedisCursor, hscanRedis2natsCursor)
+
+	// Test HSCAN returns all the fields present for the whole iteration
+	// while the fields already returned are deleted
+	for _, client := range []*redis.Client{suite.redisClient, suite.redis2natsClient} {
+		fieldsValues := make([]any, 0, 60)
+		for i := 0; i < 30; i++ {
+			fieldsValues = append(fieldsValues, fmt.Sprintf("field:%d", i), "value")
+		}
+		suite.NoError(client.HSet(ctx, "hscan:deleted", fieldsValues...).Err())
+
+		seen := map[string]bool{}
+		cursor := uint64(0)
+		for {
+			fields, next, errScan := client.HScan(ctx, "hscan:deleted", cursor, "*", 5).Result()
+			suite.NoError(errScan)
+
+			for i := 0; i < len(fields); i += 2 {
+				seen[fields[i]] = true
+				suite.NoError(client.HDel(ctx, "hscan:deleted", fields[i]).Err())
+			}
+
+			cursor = next
+			if cursor == 0 {
+				break
+			}
+		}
+
+		suite.Len(seen, 30)
+	}
+}
+
+func (suite *IntegrationTestSuite) TestKeysPrefixFilter() {
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.T().Cleanup(cancel)
+
+	for _, client := range []*redis.Client{suite.redisClient, suite.redis2natsClient} {
+		_, err := client.MSet(ctx,
+			"user.1.name", "value", "user.1.age", "value", "user.2.name", "value",
+			"user.10.name", "value", "user.1", "value", "user.1.", "value", "session:1", "value",
+			"session:", "value", "user:42:name", "value", "user:42:", "value", "user:420", "value",
+		).Result()
+		suite.NoError(err)
+	}
+
+	// The consumers listing the keys are created with the subject filters
+	conn, err := nc.Connect("nats://0.0.0.0:4222")
+	suite.NoError(err)
+	suite.T().Cleanup(conn.Close)
+
+	subscription, err := conn.SubscribeSync("$JS.API.CONSUMER.>")
+	suite.NoError(err)
+
+	consumerFilters := func() []string {
+		var filters []string
+		for {
+			msg, errNext := subscription.NextMsg(500 * time.Millisecond)
+			if errNext != nil {
+				return filters
+			}
+
+			var request struct {
+				StreamName string `json:"stream_name"`
+				Config     struct {
+					FilterSubject  string   `json:"filter_subject"`
+					FilterSubjects []string `json:"filter_subjects"`
+				} `json:"config"`
+			}
+			if json.Unmarshal(msg.Data, &request) != nil || request.StreamName != "KV_test-0" {
+				continue
+			}
+
+			if request.Config.FilterSubject != "" {
+				filters = append(filters, request.Config.FilterSubject)
+			}
+			filters = append(filters, request.Config.FilterSubjects...)
+		}
+	}
+
+	prefixFilters := map[string]string{
+		"user.1.*":  "$KV.test-0.user.1",
+		"user.1*":   "$KV.test-0.user",
+		"session:*": "$KV.test-0.session=3A",
+		"user:42:*": "$KV.test-0.user=3A.42=3A",
+	}
+
+	for _, pattern := range []string{"user.1.*", "user.1*", "user.1.name", "user.?.name", "user.*", "session:*", "user:42:*", "*"} {
+		// Skip the consumers of the previous pattern
+		consumerFilters()
+
+		// Test KEYS
+		keysRedisResult, err := suite.redisClient.Keys(ctx, pattern).Result()
+		suite.NoError(err)
+		slices.Sort(keysRedisResult)
+
+		keysRedis2natsResult, err := suite.redis2natsClient.Keys(ctx, pattern).Result()
+		suite.NoError(err)
+		slices.Sort(keysRedis2natsResult)
+
+		suite.Equal(keysRedisResult, keysRedis2natsResult, pattern)
+
+		// Test SCAN
+		scanRedis2natsResult := []string{}
+		iterator := suite.redis2natsClient.Scan(ctx, 0, pattern, 2).Iterator()
+		for iterator.Next(ctx) {
+			scanRedis2natsResult = append(scanRedis2natsResult, iterator.Val())
+		}
+		suite.NoError(iterator.Err())
+		slices.Sort(scanRedis2natsResult)
+
+		suite.Equal(keysRedisResult, scanRedis2natsResult, pattern)
+
+		// Test the subject filters are narrowed to the prefix
+		prefix, ok := prefixFilters[pattern]
+		if !ok {
+			continue
+		}
+
+		filters := consumerFilters()
+		suite.NotEmpty(filters, pattern)
+
+		for _, filter := range filters {
+			suite.True(strings.HasPrefix(filter, prefix), "pattern %s, filter %s", pattern, filter)
+		}
+	}
+}
+
+func (suite *IntegrationTestSuite) TestKeyEncoding() {
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.T().Cleanup(cancel)
+
+	keys := []string{"user name", "a*b", ".lead", "trail.", "a..b", "a=b", "unicodé", "tab\tkey", ""}
+
+	for _, key := range keys {
+		// Test SET
+		setRedisResult, err := suite.redisClient.Set(ctx, key, "value:"+key, 0).Result()
+		suite.NoError(err)
+
+		setRedis2natsResult, err := suite.redis2natsClient.Set(ctx, key, "value:"+key, 0).Result()
+		suite.NoError(err, key)
+
+		suite.Equal(setRedisResult, setRedis2natsResult, key)
+
+		// Test GET
+		getRedisResult, err := suite.redisClient.Get(ctx, key).Result()
+		suite.NoError(err)
+
+		getRedis2natsResult, err := suite.redis2natsClient.Get(ctx, key).Result()
+		suite.NoError(err, key)
+
+		suite.Equal(getRedisResult, getRedis2natsResult, key)
+	}
+
+	for _, pattern := range []string{"*", "a*", "a?b", "*.*", "unicod?"} {
+		// Test KEYS
+		keysRedisResult, err := suite.redisClient.Keys(ctx, pattern).Result()
+		suite.NoError(err)
+		slices.Sort(keysRedisResult)
+
+		keysRedis2natsResult, err := suite.redis2natsClient.Keys(ctx, pattern).Result()
+		suite.NoError(err)
+		slices.Sort(keysRedis2natsResult)
+
+		suite.Equal(keysRedisResult, keysRedis2natsResult, pattern)
+
+		// Test SCAN
+		scanRedis2natsResult := []string{}
+		iterator := suite.redis2natsClient.Scan(ctx, 0, pattern, 3).Iterator()
+		for iterator.Next(ctx) {
+			scanRedis2natsResult = append(scanRedis2natsResult, iterator.Val())
+		}
+		suite.NoError(iterator.Err())
+		slices.Sort(scanRedis2natsResult)
+
+		suite.Equal(keysRedisResult, scanRedis2natsResult, pattern)
+	}
+
+	// Test DEL
+	delRedisResult, err := suite.redisClient.Del(ctx, keys...).Result()
+	suite.NoError(err)
+
+	delRedis2natsResult, err := suite.redis2natsClient.Del(ctx, keys...).Result()
+	suite.NoError(err)
+
+	suite.Equal(delRedisResult, delRedis2natsResult)
+}
+
+func (suite *IntegrationTestSuite) TestLegacyKeyEncoding() {
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.T().Cleanup(cancel)
+
+	conn, err := nc.Connect("nats://0.0.0.0:4222")
+	suite.NoError(err)
+	suite.T().Cleanup(conn.Close)
+
+	js, err := jetstream.New(conn)
+	suite.NoError(err)
+
+	// Buckets filled by earlier versions store the keys as they are
+	store, err := js.CreateKeyValue(ctx, jetstream.KeyValueConfig{Bucket: "legacy-0"})
+	suite.NoError(err)
+
+	for _, key := range []string{"a=b", "a=41", "plain"} {
+		_, err = store.Put(ctx, key, []byte("value:"+key))
+		suite.NoError(err)
+	}
+
+	legacyServer := redisnats.NewRedisServer(
+		&redisnats.Config{
+			NATSURL:          "nats://0.0.0.0:4222",
+			NATSTimeout:      10 * time.Second,
+			NATSBucketPrefix: "legacy",
+			NATSStartupMode:  "keep",
+			NATSKeyEncoding:  "escape",
+			RedisAddress:     ":6405",
+			RedisNumDB:       16,
+		},
+	)
+
+	go func() {
+		errStart := legacyServer.Start(ctx)
+		if errStart != nil {
+			suite.T().Log(errStart)
+		}
+	}()
+
+	suite.T().Cleanup(func() {
+		legacyServer.Stop()
+	})
+
+	legacyClient := redis.NewClient(&redis.Options{
+		Addr: "0.0.0.0:6405",
+		DB:   0,
+	})
+
+	suite.T().Cleanup(func() {
+		legacyClient.Close()
+	})
+
+	suite.Eventually(func() bool {
+		return legacyClient.Ping(ctx).Err() == nil
+	}, 10*time.Second, 100*time.Millisecond)
+
+	// Test GET and KEYS on the keys stored as they are
+	for _, key := range []string{"a=b", "a=41", "plain"} {
+		getResult, errGet := legacyClient.Get(ctx, key).Result()
+		suite.NoError(errGet, key)
+		suite.Equal("value:"+key, getResult)
+	}
+
+	keysResult, err := legacyClient.Keys(ctx, "*").Result()
+	suite.NoError(err)
+	slices.Sort(keysResult)
+	suite.Equal([]string{"a=41", "a=b", "plain"}, keysResult)
+
+	// Test new buckets use the configured encoding
+	conn1 := legacyClient.Conn(ctx)
+	suite.T().Cleanup(func() {
+		conn1.Close()
+	})
+
+	suite.NoError(conn1.Select(ctx, 1).Err())
+	suite.NoError(conn1.Set(ctx, "a=b", "value", 0).Err())
+
+	store1, err := js.KeyValue(ctx, "legacy-1")
+	suite.NoError(err)
+
+	_, err = store1.Get(ctx, "a=3Db")
+	suite.NoError(err)
+}
+
+func (suite *IntegrationTestSuite) TestDBSizeRandomKey() {
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.T().Cleanup(cancel)
+
+	// Test RANDOMKEY on an empty database
+	_, err := suite.redisClient.RandomKey(ctx).Result()
+	suite.ErrorIs(err, redis.Nil)
+
+	_, err = suite.redis2natsClient.RandomKey(ctx).Result()
+	suite.ErrorIs(err, redis.Nil)
+
+	for _, client := range []*redis.Client{suite.redisClient, suite.redis2natsClient} {
+		_, err = client.MSet(ctx, "key1", "value1", "key2", "value2", "key3", "value3").Result()
+		suite.NoError(err)
+
+		_, err = client.Set(ctx, "key1", "value", 0).Result()
+		suite.NoError(err)
+
+		_, err = client.Del(ctx, "key3").Result()
+		suite.NoError(err)
+	}
+
+	// Test DBSIZE
+	dbSizeRedisResult, err := suite.redisClient.DBSize(ctx).Result()
+	suite.NoError(err)
+
+	dbSizeRedis2natsResult, err := suite.redis2natsClient.DBSize(ctx).Result()
+	suite.NoError(err)
+
+	suite.Equal(dbSizeRedisResult, dbSizeRedis2natsResult)
+
+	// Test RANDOMKEY
+	for i := 0; i < 10; i++ {
+		randomKeyRedis2natsResult, errRandomKey := suite.redis2natsClient.RandomKey(ctx).Result()
+		suite.NoError(errRandomKey)
+		suite.Contains([]string{"key1", "key2"}, randomKeyRedis2natsResult)
+	}
+
+	// Test FLUSHDB ASYNC
+	flushDBRedisResult, err := suite.redisClient.FlushDBAsync(ctx).Result()
+	suite.NoError(err)
+
+	flushDBRedis2natsResult, err := suite.redis2natsClient.FlushDBAsync(ctx).Result()
+	suite.NoError(err)
+
+	suite.Equal(flushDBRedisResult, flushDBRedis2natsResult)
+
+	suite.Eventually(func() bool {
+		dbSize, errDBSize := suite.redis2natsClient.DBSize(ctx).Result()
+		return errDBSize == nil && dbSize == 0
+	}, 10*time.Second, 100*time.Millisecond)
+
+	// Test FLUSHALL with an invalid mode
+	_, err = suite.redisClient.Do(ctx, "FLUSHALL", "LATER").Result()
+	suite.Error(err)
+
+	_, err = suite.redis2natsClient.Do(ctx, "FLUSHALL", "LATER").Result()
+	suite.Error(err)
+}
+
+func (suite *IntegrationTestSuite) TestStartupMode() {
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.T().Cleanup(cancel)
+
+	suite.Eventually(func() bool {
+		return suite.redis2natsClient.Ping(ctx).Err() == nil
+	}, 10*time.Second, 100*time.Millisecond)
+
+	_, err := suite.redis2natsClient.Set(ctx, "key", "value", 0).Result()
+	suite.NoError(err)
+
+	// Test destructive startup while another instance is running
+	flushServer := redisnats.NewRedisServer(
+		&redisnats.Config{
+			NATSURL:          "nats://0.0.0.0:4222",
+			NATSTimeout:      10 * time.Second,
+			NATSBucketPrefix: "test",
+			NATSStartupMode:  "flush-on-start",
+			RedisAddress:     ":6403",
+			RedisNumDB:       16,
+		},
+	)
+
+	err = flushServer.Start(ctx)
+	suite.ErrorIs(err, nats.ErrInstancesRunning)
+
+	// Test startup with existing buckets
+	failServer := redisnats.NewRedisServer(
+		&redisnats.Config{
+			NATSURL:          "nats://0.0.0.0:4222",
+			NATSTimeout:      10 * time.Second,
+			NATSBucketPrefix: "test",
+			NATSStartupMode:  "fail-if-exists",
+			RedisAddress:     ":6403",
+			RedisNumDB:       16,
+		},
+	)
+
+	err = failServer.Start(ctx)
+	suite.ErrorIs(err, nats.ErrBucketExists)
+
+	getResult, err := suite.redis2natsClient.Get(ctx, "key").Result()
+	suite.NoError(err)
+	suite.Equal("value", getResult)
+}
+
+func (suite *IntegrationTestSuite) TestBuckets() {
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.T().Cleanup(cancel)
+
+	suite.Eventually(func() bool {
+		return suite.redis2natsClient.Ping(ctx).Err() == nil
+	}, 10*time.Second, 100*time.Millisecond)
+
+	natsConn, err := nc.Connect("nats://0.0.0.0:4222")
+	suite.NoError(err)
+	suite.T().Cleanup(natsConn.Close)
+
+	js, err := jetstream.New(natsConn)
+	suite.NoError(err)
+
+	// Test the buckets of a database are only created on its first SELECT
+	_, err = js.KeyValue(ctx, "test-5")
+	suite.ErrorIs(err, jetstream.ErrBucketNotFound)
+
+	conn := suite.redis2natsClient.Conn(ctx)
+	suite.T().Cleanup(func() {
+		conn.Close()
+	})
+
+	for dbID := 0; dbID < 16; dbID++ {
+		suite.NoError(conn.Select(ctx, dbID).Err())
+		suite.NoError(conn.Set(ctx, "key", dbID, 0).Err())
+	}
+
+	for dbID := 0; dbID < 16; dbID++ {
+		suite.NoError(conn.Select(ctx, dbID).Err())
+
+		getResult, errGet := conn.Get(ctx, "key").Result()
+		suite.NoError(errGet)
+		suite.Equal(strconv.Itoa(dbID), getResult)
+	}
+
+	_, err = js.KeyValue(ctx, "test-5")
+	suite.NoError(err)
+
+	// Test one NATS connection serves all the databases: the other one is this test's
+	resp, err := http.Get("http://0.0.0.0:8222/connz")
+	suite.NoError(err)
+	suite.T().Cleanup(func() {
+		resp.Body.Close()
+	})
+
+	var connz struct {
+		NumConnections int `json:"num_connections"`
+	}
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&connz))
+	suite.Equal(2, connz.NumConnections)
+
+	// Test the existing buckets are reconciled at startup, before their first SELECT
+	_, err = js.CreateKeyValue(ctx, jetstream.KeyValueConfig{Bucket: "reconcile-3", History: 1})
+	suite.NoError(err)
+
+	reconcileServer := redisnats.NewRedisServer(
+		&redisnats.Config{
+			NATSURL:          "nats://0.0.0.0:4222",
+			NATSTimeout:      10 * time.Second,
+			NATSBucketPrefix: "reconcile",
+			NATSStartupMode:  "keep",
+			NATSBucket:       nats.BucketConfig{History: 5, Reconcile: true},
+			RedisAddress:     ":6404",
+			RedisNumDB:       16,
+		},
+	)
+
+	go func() {
+		errStart := reconcileServer.Start(ctx)
+		if errStart != nil {
+			suite.T().Log(errStart)
+		}
+	}()
+
+	suite.T().Cleanup(func() {
+		reconcileServer.Stop()
+	})
+
+	reconcileClient := redis.NewClient(&redis.Options{
+		Addr: "0.0.0.0:6404",
+		DB:   0,
+	})
+
+	suite.T().Cleanup(func() {
+		reconcileClient.Close()
+	})
+
+	suite.Eventually(func() bool {
+		return reconcileClient.Ping(ctx).Err() == nil
+	}, 10*time.Second, 100*time.Millisecond)
+
+	stream, err := js.Stream(ctx, "KV_reconcile-3")
+	suite.NoError(err)
+	suite.Equal(int64(5), stream.CachedInfo().Config.MaxMsgsPerSubject)
+
+	_, err = js.KeyValue(ctx, "reconcile-4")
+	suite.ErrorIs(err, jetstream.ErrBucketNotFound)
+}
+
+func (suite *IntegrationTestSuite) TestOpenBuckets() {
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.T().Cleanup(cancel)
+
+	suite.Eventually(func() bool {
+		return suite.redis2natsClient.Ping(ctx).Err() == nil
+	}, 10*time.Second, 100*time.Millisecond)
+
+	natsConn, err := nc.Connect("nats://0.0.0.0:4222")
+	suite.NoError(err)
+	suite.T().Cleanup(natsConn.Close)
+
+	js, err := jetstream.New(natsConn)
+	suite.NoError(err)
+
+	conn := suite.redis2natsClient.Conn(ctx)
+	suite.T().Cleanup(func() {
+		conn.Close()
+	})
+
+	// Test SELECT creates the buckets of the database
+	_, err = js.KeyValue(ctx, "test-3")
+	suite.ErrorIs(err, jetstream.ErrBucketNotFound)
+
+	suite.NoError(conn.Select(ctx, 3).Err())
+	suite.NoError(conn.Set(ctx, "key", "value", 0).Err())
+
+	_, err = js.KeyValue(ctx, "test-3")
+	suite.NoError(err)
+
+	// Test MOVE creates the buckets of the destination database
+	_, err = js.KeyValue(ctx, "test-4")
+	suite.ErrorIs(err, jetstream.ErrBucketNotFound)
+
+	moveResult, err := conn.Move(ctx, "key", 4).Result()
+	suite.NoError(err)
+	suite.True(moveResult)
+
+	_, err = js.KeyValue(ctx, "test-4")
+	suite.NoError(err)
+
+	suite.NoError(conn.Select(ctx, 4).Err())
+
+	getResult, err := conn.Get(ctx, "key").Result()
+	suite.NoError(err)
+	suite.Equal("value", getResult)
+
+	// Test SWAPDB creates the buckets of the swapped databases
+	_, err = js.KeyValue(ctx, "test-5")
+	suite.ErrorIs(err, jetstream.ErrBucketNotFound)
+
+	suite.NoError(conn.Process(ctx, redis.NewCmd(ctx, "SWAPDB", 4, 5)))
+
+	_, err = js.KeyValue(ctx, "test-5")
+	suite.NoError(err)
+
+	suite.ErrorIs(conn.Get(ctx, "key").Err(), redis.Nil)
+
+	// Test a mapping whose buckets cannot be created fails the commands until it is applied
+	_, err = js.CreateStream(ctx, jetstream.StreamConfig{Name: "blocker", Subjects: []string{"$KV.test-9.>"}})
+	suite.NoError(err)
+
+	suite.Error(conn.Process(ctx, redis.NewCmd(ctx, "SWAPDB", 4, 9)))
+
+	err = conn.Get(ctx, "key").Err()
+	suite.Error(err)
+	suite.Equal("ERR the databases swapped by SWAPDB could not be opened", err.Error())
+
+	suite.NoError(js.DeleteStream(ctx, "blocker"))
+
+	suite.Eventually(func() bool {
+		return conn.Get(ctx, "key").Err() == redis.Nil
+	}, 10*time.Second, 100*time.Millisecond)
+
+	suite.NoError(conn.Select(ctx, 5).Err())
+
+	getResult, err = conn.Get(ctx, "key").Result()
+	suite.NoError(err)
+	suite.Equal("value", getResult)
+}
+
+func (suite *IntegrationTestSuite) TestSwapDBMove() {
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.T().Cleanup(cancel)
+
+	for _, client := range []*redis.Client{suite.redisClient, suite.redis2natsClient} {
+		_, err := client.Set(ctx, "key", "value", 0).Result()
+		suite.NoError(err)
+	}
+
+	// Test MOVE
+	moveRedisResult, err := suite.redisClient.Move(ctx, "key", 1).Result()
+	suite.NoError(err)
+
+	moveRedis2natsResult, err := suite.redis2natsClient.Move(ctx, "key", 1).Result()
+	suite.NoError(err)
+
+	suite.Equal(moveRedisResult, moveRedis2natsResult)
+
+	// Test MOVE with missing key
+	moveRedisResult, err = suite.redisClient.Move(ctx, "key", 1).Result()
+	suite.NoError(err)
+
+	moveRedis2natsResult, err = suite.redis2natsClient.Move(ctx, "key", 1).Result()
+	suite.NoError(err)
+
+	suite.Equal(moveRedisResult, moveRedis2natsResult)
+
+	// Test SWAPDB
+	swapRedisResult, err := suite.redisClient.Do(ctx, "SWAPDB", 0, 1).Result()
+	suite.NoError(err)
+
+	swapRedis2natsResult, err := suite.redis2natsClient.Do(ctx, "SWAPDB", 0, 1).Result()
+	suite.NoError(err)
+
+	suite.Equal(swapRedisResult, swapRedis2natsResult)
+
+	getRedisResult, err := suite.redisClient.Get(ctx, "key").Result()
+	suite.NoError(err)
+
+	getRedis2natsResult, err := suite.redis2natsClient.Get(ctx, "key").Result()
+	suite.NoError(err)
+
+	suite.Equal(getRedisResult, getRedis2natsResult)
+
+	// Test SWAPDB with invalid database
+	_, err = suite.redisClient.Do(ctx, "SWAPDB", 0, 17).Result()
+	suite.Error(err)
+
+	_, errRedis2nats := suite.redis2natsClient.Do(ctx, "SWAPDB", 0, 17).Result()
+	suite.Error(errRedis2nats)
+
+	suite.Equal(err.Error(), errRedis2nats.Error())
+
+	// Start a second instance sharing the same buckets
+	secondServer := redisnats.NewRedisServer(
+		&redisnats.Config{
+			NATSURL:          "nats://0.0.0.0:4222",
+			NATSTimeout:      10 * time.Second,
+			NATSBucketPrefix: "test",
+			NATSStartupMode:  "keep",
+			RedisAddress:     ":6401",
+			RedisNumDB:       16,
+		},
+	)
+
+	go func() {
+		errStart := secondServer.Start(ctx)
+		if errStart != nil {
+			suite.T().Log(errStart)
+		}
+	}()
+
+	suite.T().Cleanup(func() {
+		secondServer.Stop()
+	})
+
+	secondClient := redis.NewClient(&redis.Options{
+		Addr: "0.0.0.0:6401",
+		DB:   0,
+	})
+
+	suite.T().Cleanup(func() {
+		secondClient.Close()
+	})
+
+	suite.Eventually(func() bool {
+		return secondClient.Ping(ctx).Err() == nil
+	}, 10*time.Second, 100*time.Millisecond)
+
+	// Test the second instance starts with the swapped databases
+	getSecondResult, err := secondClient.Get(ctx, "key").Result()
+	suite.NoError(err)
+	suite.Equal(getRedis2natsResult, getSecondResult)
+
+	// Test SWAPDB swaps the databases of the second instance as well
+	_, err = suite.redis2natsClient.Do(ctx, "SWAPDB", 0, 1).Result()
+	suite.NoError(err)
+
+	suite.Eventually(func() bool {
+		return secondClient.Get(ctx, "key").Err() == redis.Nil
+	}, 10*time.Second, 100*time.Millisecond)
+}
+
+func (suite *IntegrationTestSuite) TestACL() {
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.T().Cleanup(cancel)
+
+	// Test ACL SETUSER
+	setuserRedisResult, err := suite.redisClient.Do(ctx, "ACL", "SETUSER", "alice", "on", ">secret", "~cache:*", "+@read").Result()
+	suite.NoError(err)
+
+	setuserRedis2natsResult, err := suite.redis2natsClient.Do(ctx, "ACL", "SETUSER", "alice", "on", ">secret", "~cache:*", "+@read").Result()
+	suite.NoError(err)
+
+	suite.Equal(setuserRedisResult, setuserRedis2natsResult)
+
+	// Test AUTH with wrong password
+	_, err = suite.redisClient.Do(ctx, "AUTH", "alice", "wrong").Result()
+	suite.Error(err)
+
+	_, errRedis2nats := suite.redis2natsClient.Do(ctx, "AUTH", "alice", "wrong").Result()
+	suite.Error(errRedis2nats)
+
+	suite.Equal(err.Error(), errRedis2nats.Error())
+
+	for _, addr := range []string{"0.0.0.0:6379", "0.0.0.0:6400"} {
+		client := redis.NewClient(&redis.Options{
+			Addr:     addr,
+			Username: "alice",
+			Password: "secret",
+		})
+		suite.T().Cleanup(func() {
+			client.Close()
+		})
+
+		// Test ACL WHOAMI, which is not in the allowed categories
+		whoamiResult, errWhoami := client.Do(ctx, "ACL", "WHOAMI").Result()
+		suite.Error(errWhoami)
+		suite.Nil(whoamiResult)
+
+		// Test allowed command and key
+		_, errGet := client.Get(ctx, "cache:1").Result()
+		suite.ErrorIs(errGet, redis.Nil)
+
+		// Test forbidden key
+		_, errGet = client.Get(ctx, "other").Result()
+		suite.ErrorContains(errGet, "NOPERM")
+
+		// Test forbidden command
+		_, errSet := client.Set(ctx, "cache:1", "value", 0).Result()
+		suite.ErrorContains(errSet, "NOPERM")
+	}
+
+	// Test ACL DELUSER
+	deluserRedisResult, err := suite.redisClient.Do(ctx, "ACL", "DELUSER", "alice").Result()
+	suite.NoError(err)
+
+	deluserRedis2natsResult, err := suite.redis2natsClient.Do(ctx, "ACL", "DELUSER", "alice").Result()
+	suite.NoError(err)
+
+	suite.Equal(deluserRedisResult, deluserRedis2natsResult)
+}
+
+func (suite *IntegrationTestSuite) TestTLS() {
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.T().Cleanup(cancel)
+
+	dir := suite.T().TempDir()
+	certificates, err := generateCertificates(dir)
+	suite.NoError(err)
+
+	// Start a TLS instance sharing the same buckets
+	tlsServer := redisnats.NewRedisServer(
+		&redisnats.Config{
+			NATSURL:          "nats://0.0.0.0:4222",
+			NATSTimeout:      10 * time.Second,
+			NATSBucketPrefix: "test",
+			NATSStartupMode:  "keep",
+			RedisAddress:     ":6402",
+			RedisNumDB:       16,
+			RedisUsers:       []string{"user alice on ~* +@all"},
+			RedisTLS: &redisnats.TLSConfig{
+				CertFile:        filepath.Join(dir, "server.crt"),
+				KeyFile:         filepath.Join(dir, "server.key"),
+				CAFile:          filepath.Join(dir, "ca.crt"),
+				AuthClients:     "yes",
+				MinVersion:      "1.2",
+				AuthClientsUser: "CN",
+			},
+		},
+	)
+
+	go func() {
+		errStart := tlsServer.Start(ctx)
+		if errStart != nil {
+			suite.T().Log(errStart)
+		}
+	}()
+
+	suite.T().Cleanup(func() {
+		tlsServer.Stop()
+	})
+
+	tlsClient := redis.NewClient(&redis.Options{
+		Addr: "localhost:6402",
+		TLSConfig: &tls.Config{
+			RootCAs:      certificates.RootCAs,
+			Certificates: certificates.Certificates,
+			MinVersion:   tls.VersionTLS12,
+		},
+	})
+
+	suite.T().Cleanup(func() {
+		tlsClient.Close()
+	})
+
+	suite.Eventually(func() bool {
+		return tlsClient.Ping(ctx).Err() == nil
+	}, 10*time.Second, 100*time.Millisecond)
+
+	// Test client certificate to ACL user mapping
+	whoamiResult, err := tlsClient.Do(ctx, "ACL", "WHOAMI").Result()
+	suite.NoError(err)
+	suite.Equal("alice", whoamiResult)
+
+	// Test commands over TLS
+	setResult, err := tlsClient.Set(ctx, "key", "value", 0).Result()
+	suite.NoError(err)
+	suite.Equal("OK", setResult)
+
+	getResult, err := suite.redis2natsClient.Get(ctx, "key").Result()
+	suite.NoError(err)
+	suite.Equal("value", getResult)
+
+	// Test client without certificate
+	noCertClient := redis.NewClient(&redis.Options{
+		Addr: "localhost:6402",
+		TLSConfig: &tls.Config{
+			RootCAs:    certificates.RootCAs,
+			MinVersion: tls.VersionTLS12,
+		},
+		MaxRetries: -1,
+	})
+
+	suite.T().Cleanup(func() {
+		noCertClient.Close()
+	})
+
+	suite.Error(noCertClient.Ping(ctx).Err())
+}
+
+// generateCertificates writes a self-signed CA (ca.crt), a server certificate
+// (server.crt, server.key) and returns a client TLS configuration with the
+// client certificate of the alice user.
+func generateCertificates(dir string) (*tls.Config, error) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "redis2nats test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, err
+	}
+
+	issue := func(serial int64, commonName string, usage x509.ExtKeyUsage) ([]byte, []byte, error) {
+		key, errKey := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if errKey != nil {
+			return nil, nil, errKey
+		}
+
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: commonName},
+			DNSNames:     []string{"localhost"},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		}
+
+		der, errCert := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+		if errCert != nil {
+			return nil, nil, errCert
+		}
+
+		keyDER, errMarshal := x509.MarshalECPrivateKey(key)
+		if errMarshal != nil {
+			return nil, nil, errMarshal
+		}
+
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+			pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), nil
+	}
+
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})
+
+	serverCert, serverKey, err := issue(2, "localhost", x509.ExtKeyUsageServerAuth)
+	if err != nil {
+		return nil, err
+	}
+
+	clientCert, clientKey, err := issue(3, "alice", x509.ExtKeyUsageClientAuth)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string][]byte{"ca.crt": caPEM, "server.crt": serverCert, "server.key": serverKey}
+	for name, data := range files {
+		err = os.WriteFile(filepath.Join(dir, name), data, 0o600)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	clientCertificate, err := tls.X509KeyPair(clientCert, clientKey)
+	if err != nil {
+		return nil, err
+	}
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(caCert)
+
+	return &tls.Config{
+		RootCAs:      rootCAs,
+		Certificates: []tls.Certificate{clientCertificate},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+func (suite *IntegrationTestSuite) TestHello() {
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.T().Cleanup(cancel)
+
+	// Test HELLO 2
+	helloRedisResult, err := suite.redisClient.Do(ctx, "HELLO", 2).Slice()
+	suite.NoError(err)
+
+	helloRedis2natsResult, err := suite.redis2natsClient.Do(ctx, "HELLO", 2).Slice()
+	suite.NoError(err)
+
+	suite.Equal(len(helloRedisResult), len(helloRedis2natsResult))
+	suite.Equal(helloRedisResult[4:6], helloRedis2natsResult[4:6])
+
+	// Test HELLO with unsupported protocol
+	_, err = suite.redisClient.Do(ctx, "HELLO", 4).Result()
+	suite.Error(err)
+
+	_, errRedis2nats := suite.redis2natsClient.Do(ctx, "HELLO", 4).Result()
+	suite.Error(errRedis2nats)
+
+	suite.Equal(err.Error(), errRedis2nats.Error())
+}
+
+func (suite *IntegrationTestSuite) TestNotSupported() {
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.T().Cleanup(cancel)
+
+	// Test unsupported command
+	_, errRedis := suite.redisClient.Do(ctx, "NOTSUPPORTED", "arg").Result()
+	suite.Error(errRedis)
+
+	_, errRedis2nats := suite.redis2natsClient.Do(ctx, "NOTSUPPORTED", "arg").Result()
+	suite.Error(errRedis2nats)
+
+	suite.Equal(errRedis.Error(), errRedis2nats.Error())
+}
+
+func (suite *IntegrationTestSuite) TestInvalidCommand() {
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.T().Cleanup(cancel)
+
+	// Test unsupported command
+	_, errRedis := suite.redisClient.Do(ctx, "GET", "KEY", "OTHER", "COMMAND").Result()
+	suite.Error(errRedis)
+
+	_, errRedis2nats := suite.redis2natsClient.Do(ctx, "GET", "KEY", "OTHER", "COMMAND").Result()
+	suite.Error(errRedis2nats)
+
+	suite.Equal(errRedis.Error(), errRedis2nats.Error())
+}
+
+func (suite *IntegrationTestSuite) TestErrors() {
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.T().Cleanup(cancel)
+
+	for _, client := range []*redis.Client{suite.redisClient, suite.redis2natsClient} {
+		_, err := client.Set(ctx, "string", "value", 0).Result()
+		suite.NoError(err)
+	}
+
+	commands := [][]interface{}{
+		{"INCR", "string"},
+		{"DECR", "string"},
+		{"EXPIRE", "string", "soon"},
+		{"LRANGE", "list", "start", "stop"},
+		{"LPOP", "list", -1},
+		{"SELECT", "db"},
+		{"SELECT", 1000},
+		{"MOVE", "string", "db"},
+		{"HSET", "hash", "field"},
+		{"MSET", "key"},
+		{"SET", "key", "value", "EX", "soon"},
+		{"SET", "key", "value", "EX", 0},
+		{"ACL", "SETUSER"},
+		{"SCAN", 0, "COUNT", "many"},
+		{"HELLO", "proto"},
+		{"HELLO", 4},
+	}
+
+	for _, command := range commands {
+		_, errRedis := suite.redisClient.Do(ctx, command...).Result()
+		suite.Error(errRedis)
+
+		_, errRedis2nats := suite.redis2natsClient.Do(ctx, command...).Result()
+		suite.Error(errRedis2nats)
+
+		suite.Equal(errRedis.Error(), errRedis2nats.Error(), command)
+	}
+}
+
+func (suite *IntegrationTestSuite) TestInlineCommand() {
+	commands := []string{
+		"PING\r\n",
+		"SET key \"va lue\\t\"\r\n",
+		"GET key\r\n",
+		"SET key 'it\\'s'\r\n",
+		"GET key\r\n",
+	}
+
+	redisConn, err := net.Dial("tcp", "0.0.0.0:6379")
+	suite.NoError(err)
+	suite.T().Cleanup(func() {
+		redisConn.Close()
+	})
+
+	redis2natsConn, err := net.Dial("tcp", "0.0.0.0:6400")
+	suite.NoError(err)
+	suite.T().Cleanup(func() {
+		redis2natsConn.Close()
+	})
+
+	redisReader := bufio.NewReader(redisConn)
+	redis2natsReader := bufio.NewReader(redis2natsConn)
+
+	for _, command := range commands {
+		_, err = redisConn.Write([]byte(command))
+		suite.NoError(err)
+
+		_, err = redis2natsConn.Write([]byte(command))
+		suite.NoError(err)
+
+		redisResult, err := redisReader.ReadString('\n')
+		suite.NoError(err)
+
+		redis2natsResult, err := redis2natsReader.ReadString('\n')
+		suite.NoError(err)
+
+		suite.Equal(redisResult, redis2natsResult)
+
+		// Read the payload of bulk string replies
+		if strings.HasPrefix(redisResult, "$") && redisResult != "$-1\r\n" {
+			redisResult, err = redisReader.ReadString('\n')
+			suite.NoError(err)
+
+			redis2natsResult, err = redis2natsReader.ReadString('\n')
+			suite.NoError(err)
+
+			suite.Equal(redisResult, redis2natsResult)
+		}
+	}
+}
+
+func (suite *IntegrationTestSuite) TestProtocolErrors() {
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.T().Cleanup(cancel)
+
+	requests := []string{
+		"*abc\r\n",
+		"*1\r\n$abc\r\n",
+		"*1\r\n+PING\r\n",
+		"SET key \"value\r\n",
+		strings.Repeat("a", 70*1024),
+	}
+
+	// Clients that did not authenticate are limited to short requests
+	unauthenticatedRequests := []string{
+		"*11\r\n",
+		"*2\r\n$20000\r\n",
+	}
+
+	_, err := suite.redisClient.Do(ctx, "ACL", "SETUSER", "default", ">secret").Result()
+	suite.NoError(err)
+
+	_, err = suite.redis2natsClient.Do(ctx, "ACL", "SETUSER", "default", ">secret").Result()
+	suite.NoError(err)
+
+	for _, request := range append(requests, unauthenticatedRequests...) {
+		var results []string
+		for _, addr := range []string{"0.0.0.0:6379", "0.0.0.0:6400"} {
+			conn, errDial := net.Dial("tcp", addr)
+			suite.NoError(errDial)
+
+			_, errWrite := conn.Write([]byte(request))
+			suite.NoError(errWrite)
+
+			reader := bufio.NewReader(conn)
+			result, errRead := reader.ReadString('\n')
+			suite.NoError(errRead)
+
+			// The connection is closed after a protocol error
+			_, errRead = reader.ReadString('\n')
+			suite.ErrorIs(errRead, io.EOF)
+
+			conn.Close()
+			results = append(results, result)
+		}
+
+		suite.Equal(results[0], results[1], request)
+	}
+}
+
+func (suite *IntegrationTestSuite) TestReplyConformance() {
+	setup := [][]string{
+		{"FLUSHDB"},
+		{"SET", "string", "value"},
+		{"SET", "empty", ""},
+		{"SET", "crlf", "line\r\nline"},
+		{"HSET", "hash", "field", "value"},
+		{"HSET", "hash2", "empty", ""},
+		{"LPUSH", "list", "value", ""},
+	}
+
+	commands := [][]string{
+		{"GET", "string"},
+		{"GET", "empty"},
+		{"GET", "crlf"},
+		{"GET", "missing"},
+		{"MGET", "string", "empty", "missing", "hash"},
+		{"SET", "missing", "value", "XX"},
+		{"SETNX", "string", "value"},
+		{"SETNX", "new", "value"},
+		{"HGET", "hash", "field"},
+		{"HGET", "hash", "missing"},
+		{"HGET", "missing", "field"},
+		{"HGETALL", "hash2"},
+		{"HGETALL", "missing"},
+		{"HKEYS", "hash2"},
+		{"HKEYS", "missing"},
+		{"HEXISTS", "hash", "field"},
+		{"HLEN", "hash"},
+		{"LRANGE", "list", "0", "-1"},
+		{"LRANGE", "missing", "0", "-1"},
+		{"LRANGE", "list", "1", "0"},
+		{"LRANGE", "list", "-1", "-2"},
+		{"LPOP", "list"},
+		{"LPOP", "list", "5"},
+		{"LPOP", "list"},
+		{"LPOP", "list", "1"},
+		{"LPOP", "missing", "1"},
+		{"KEYS", "empty"},
+		{"TYPE", "hash"},
+		{"TYPE", "missing"},
+		{"EXISTS", "string", "missing"},
+		{"DEL", "missing"},
+		{"TTL", "string"},
+		{"TTL", "missing"},
+		{"INCR", "counter"},
+	}
+
+	for _, protocol := range []string{"2", "3"} {
+		redisConn, err := net.Dial("tcp", "0.0.0.0:6379")
+		suite.NoError(err)
+		suite.T().Cleanup(func() {
+			redisConn.Close()
+		})
+
+		redis2natsConn, err := net.Dial("tcp", "0.0.0.0:6400")
+		suite.NoError(err)
+		suite.T().Cleanup(func() {
+			redis2natsConn.Close()
+		})
+
+		redisReader := bufio.NewReader(redisConn)
+		redis2natsReader := bufio.NewReader(redis2natsConn)
+
+		// The server properties differ
+		for _, conn := range []net.Conn{redisConn, redis2natsConn} {
+			_, err = conn.Write([]byte(fmtCommand("HELLO", protocol)))
+			suite.NoError(err)
+		}
+
+		_, err = readReply(redisReader)
+		suite.NoError(err)
+
+		_, err = readReply(redis2natsReader)
+		suite.NoError(err)
+
+		for _, command := range append(setup, commands...) {
+			_, err = redisConn.Write([]byte(fmtCommand(command...)))
+			suite.NoError(err)
+
+			_, err = redis2natsConn.Write([]byte(fmtCommand(command...)))
+			suite.NoError(err)
+
+			redisResult, err := readReply(redisReader)
+			suite.NoError(err)
+
+			redis2natsResult, err := readReply(redis2natsReader)
+			suite.NoError(err)
+
+			suite.Equal(redisResult, redis2natsResult, "RESP%s %v", protocol, command)
+		}
+	}
+}
+
+// fmtCommand encodes a command as a RESP array of bulk strings.
+func fmtCommand(args ...string) string {
+	var command strings.Builder
+	fmt.Fprintf(&command, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&command, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	return command.String()
+}
+
+// readReply reads a whole RESP2 or RESP3 reply and returns its encoding.
+func readReply(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	switch line[0] {
+	case '$', '=', '!':
+		length, errAtoi := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if errAtoi != nil || length < 0 {
+			return line, errAtoi
+		}
+
+		payload := make([]byte, length+2)
+		_, err = io.ReadFull(reader, payload)
+
+		return line + string(payload), err
+	case '*', '%', '~', '>':
+		count, errAtoi := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if errAtoi != nil || count < 0 {
+			return line, errAtoi
+		}
+
+		if line[0] == '%' {
+			count *= 2
+		}
+
+		reply := line
+		for i := 0; i < count; i++ {
+			element, errElement := readReply(reader)
+			if errElement != nil {
+				return reply, errElement
+			}
+			reply += element
+		}
+
+		return reply, nil
+	default:
+		return line, nil
+	}
 }
 
 func TestIntegrationTestSuite(t *testing.T) {
@@ -0,0 +1,132 @@
+package redisnats
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+const (
+	tlsAuthClientsNo       = "no"
+	tlsAuthClientsOptional = "optional"
+	tlsAuthClientsYes      = "yes"
+
+	// tlsAuthClientsUserCN maps the common name of the client certificate to an ACL user.
+	tlsAuthClientsUserCN = "CN"
+)
+
+// tlsVersions are the supported TLS versions, by name.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLSConfig represents the TLS configuration of the Redis listener.
+type TLSConfig struct {
+	// CertFile and KeyFile are the server certificate and private key.
+	CertFile string
+	KeyFile  string
+	// CAFile is the CA bundle used to verify the client certificates.
+	CAFile string
+	// AuthClients is the client certificate mode: no, optional or yes (the default).
+	AuthClients string
+	// MinVersion is the minimum TLS version: 1.0, 1.1, 1.2 (the default) or 1.3.
+	MinVersion string
+	// CipherSuites are the names of the TLS 1.0-1.2 cipher suites, empty for the Go defaults.
+	CipherSuites []string
+	// AuthClientsUser is the client certificate field used to authenticate
+	// the client as the ACL user with the same name: CN, or empty to disable it.
+	AuthClientsUser string
+}
+
+// tlsConfig builds the crypto/tls configuration.
+func (c *TLSConfig) tlsConfig() (*tls.Config, error) {
+	certificate, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if c.MinVersion != "" {
+		version, ok := tlsVersions[c.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrTLSVersion, c.MinVersion)
+		}
+		config.MinVersion = version
+	}
+
+	for _, name := range c.CipherSuites {
+		id, errCipher := cipherSuiteID(name)
+		if errCipher != nil {
+			return nil, errCipher
+		}
+		config.CipherSuites = append(config.CipherSuites, id)
+	}
+
+	switch c.AuthClients {
+	case tlsAuthClientsNo:
+		config.ClientAuth = tls.NoClientCert
+	case tlsAuthClientsOptional:
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	case tlsAuthClientsYes, "":
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrTLSAuthClients, c.AuthClients)
+	}
+
+	if c.AuthClientsUser != "" && c.AuthClientsUser != tlsAuthClientsUserCN {
+		return nil, fmt.Errorf("%w: %s", ErrTLSAuthClientsUser, c.AuthClientsUser)
+	}
+
+	if config.ClientAuth != tls.NoClientCert {
+		pool, errCA := loadCertPool(c.CAFile)
+		if errCA != nil {
+			return nil, errCA
+		}
+		config.ClientCAs = pool
+	}
+
+	return config, nil
+}
+
+// certificateUser returns the ACL user named after the client certificate, if any.
+func (c *TLSConfig) certificateUser(state tls.ConnectionState) string {
+	if c.AuthClientsUser != tlsAuthClientsUserCN || len(state.PeerCertificates) == 0 {
+		return ""
+	}
+
+	return state.PeerCertificates[0].Subject.CommonName
+}
+
+// loadCertPool reads a PEM encoded CA bundle.
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%w: %s", ErrTLSCA, caFile)
+	}
+
+	return pool, nil
+}
+
+// cipherSuiteID returns the ID of a secure cipher suite given its name.
+func cipherSuiteID(name string) (uint16, error) {
+	for _, suite := range tls.CipherSuites() {
+		if suite.Name == name {
+			return suite.ID, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w: %s", ErrTLSCipherSuite, name)
+}
@@ -0,0 +1,135 @@
+package redisnats
+
+import (
+	"context"
+
+	"github.com/henomis/redis2nats/nats"
+)
+
+// transaction holds the commands queued between MULTI and EXEC.
+type transaction struct {
+	queued [][]string
+	// aborted is set when a command could not be queued, EXEC will then fail.
+	aborted bool
+}
+
+// isTransactionCommand reports whether the command controls the transaction
+// and must be run immediately instead of being queued.
+func isTransactionCommand(commandName string) bool {
+	switch commandName {
+	case "MULTI", "EXEC", "DISCARD", "WATCH":
+		return true
+	default:
+		return false
+	}
+}
+
+// queueCommand adds the command to the current transaction.
+func (c *Command) queueCommand(commandParts []string) string {
+	c.session.tx.queued = append(c.session.tx.queued, commandParts)
+	return redisQueued
+}
+
+// abortTransaction flags the current transaction, if any, so that EXEC fails.
+func (c *Command) abortTransaction() {
+	if c.session.tx != nil {
+		c.session.tx.aborted = true
+	}
+}
+
+// cmdMulti marks the start of a transaction.
+func (c *Command) cmdMulti(_ context.Context, _ ...string) (string, error) {
+	if c.session.tx != nil {
+		return redisNOP, ErrMultiNested
+	}
+
+	c.session.tx = &transaction{}
+
+	return redisOK, nil
+}
+
+// cmdDiscard discards the commands queued in the current transaction.
+func (c *Command) cmdDiscard(_ context.Context, _ ...string) (string, error) {
+	if c.session.tx == nil {
+		return redisNOP, ErrDiscardWithoutMulti
+	}
+
+	c.session.tx = nil
+	c.session.watch = nil
+
+	return redisOK, nil
+}
+
+// cmdWatch records the revision of the keys, so that EXEC fails if any of them changes.
+func (c *Command) cmdWatch(ctx context.Context, args ...string) (string, error) {
+	if c.session.tx != nil {
+		return redisNOP, ErrWatchInsideMulti
+	}
+
+	if c.session.watch == nil {
+		c.session.watch = nats.NewWatch()
+		c.session.watchSwaps = c.databases.swaps
+	}
+
+	err := c.session.watch.Add(ctx, c.storage(), args...)
+	if err != nil {
+		return redisNOP, storageError(err)
+	}
+
+	return redisOK, nil
+}
+
+// cmdUnwatch forgets all the watched keys.
+func (c *Command) cmdUnwatch(_ context.Context, _ ...string) (string, error) {
+	c.session.watch = nil
+
+	return redisOK, nil
+}
+
+// cmdExec runs the commands queued in the current transaction and returns their replies.
+// The caller holds the locks of the keys used by the queued commands, so no other
+// client of this instance can use them until the transaction completes.
+// If a watched key was modified, the transaction is not run and a null reply is returned.
+// The watched keys are checked with writes conditional on their revision before any
+// queued command runs, so that keys modified by other instances sharing the same
+// buckets are detected as well.
+func (c *Command) cmdExec(ctx context.Context, _ ...string) (string, error) {
+	if c.session.tx == nil {
+		return redisNOP, ErrExecWithoutMulti
+	}
+
+	tx, watch := c.session.tx, c.session.watch
+	c.session.tx, c.session.watch = nil, nil
+
+	if tx.aborted {
+		return redisNOP, ErrExecAbort
+	}
+
+	if watch != nil {
+		// Swapping databases touches all the watched keys
+		if c.databases.swaps != c.session.watchSwaps {
+			return c.reply().NullArray(), nil
+		}
+
+		changed, err := watch.Claim(ctx)
+		if err != nil {
+			return redisNOP, storageError(err)
+		}
+
+		if changed {
+			return c.reply().NullArray(), nil
+		}
+	}
+
+	replies := make([]string, 0, len(tx.queued))
+	for _, commandParts := range tx.queued {
+		response, err := c.dispatch(context.Background(), commandParts)
+		if err != nil {
+			response = fmtError(err)
+		}
+
+		replies = append(replies, response)
+	}
+
+	return c.reply().Array(replies...), nil
+}
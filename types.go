@@ -1,7 +1,9 @@
 package redisnats
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 )
@@ -13,23 +15,37 @@ const (
 	redisbulkStringPrefix              = "$"
 	redisLF                            = '\n'
 	redisArrayPrefix                   = "*"
+	redisNullPrefix                    = "_"
+	redisMapPrefix                     = "%"
+	redisSetPrefix                     = "~"
+	redisDoublePrefix                  = ","
+	redisBooleanPrefix                 = "#"
+	redisPushPrefix                    = ">"
 	redisNOP              redisCommand = ""
-	redisNotFound         redisCommand = "_\r\n"
 	defaultKeysPattern    redisCommand = "*"
 )
 
+const (
+	protocolRESP2 = 2
+	protocolRESP3 = 3
+)
+
+const (
+	redisServerName    = "redis"
+	redisServerVersion = "7.2.0"
+)
+
 type Option = string
 
 const (
-	optionSetXX Option = "XX"
-	optionSetNX Option = "NX"
-	optionSetEX Option = "EX"
+	optionHelloAuth    Option = "AUTH"
+	optionHelloSetName Option = "SETNAME"
 )
 
 var (
-	redisPong = fmtSimpleString("PONG")
-	redisOK   = fmtSimpleString("OK")
-	redisNil  = fmtNullBulkString()
+	redisPong   = fmtSimpleString("PONG")
+	redisOK     = fmtSimpleString("OK")
+	redisQueued = fmtSimpleString("QUEUED")
 )
 
 func fmtSimpleString(value string) string {
@@ -40,6 +56,17 @@ func fmtSimpleError(value string) string {
 	return fmt.Sprintf("-ERR %s%s", value, redisCRLF)
 }
 
+// fmtError formats an error reply, keeping the prefix of a PrefixedError
+// and falling back to the generic ERR prefix otherwise.
+func fmtError(err error) string {
+	var prefixedError PrefixedError
+	if errors.As(err, &prefixedError) {
+		return fmt.Sprintf("-%s%s", prefixedError.Error(), redisCRLF)
+	}
+
+	return fmtSimpleError(err.Error())
+}
+
 func fmtInt(value int) string {
 	return fmt.Sprintf(":%d%s", value, redisCRLF)
 }
@@ -56,6 +83,7 @@ func fmtNullBulkString() string {
 	return fmt.Sprintf("%s%d%s", redisbulkStringPrefix, -1, redisCRLF)
 }
 
+// fmtArrayOfString formats a RESP array of bulk strings.
 func fmtArrayOfString(values ...string) string {
 	var response strings.Builder
 	response.WriteString(redisArrayPrefix)
@@ -63,12 +91,162 @@ func fmtArrayOfString(values ...string) string {
 	response.WriteString(redisCRLF)
 
 	for _, value := range values {
-		if value == "" {
-			response.WriteString(fmtNullBulkString())
+		response.WriteString(fmtBulkString(value))
+	}
+
+	return response.String()
+}
+
+// fmtAggregate formats an aggregate reply (array, map, set, push) made of already encoded elements.
+func fmtAggregate(prefix string, length int, elements ...string) string {
+	var response strings.Builder
+	response.WriteString(prefix)
+	response.WriteString(strconv.Itoa(length))
+	response.WriteString(redisCRLF)
+
+	for _, element := range elements {
+		response.WriteString(element)
+	}
+
+	return response.String()
+}
+
+// fmtFloat formats a floating point number the way Redis does.
+func fmtFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "inf"
+	case math.IsInf(value, -1):
+		return "-inf"
+	case math.IsNaN(value):
+		return "nan"
+	default:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+}
+
+// replyEncoder encodes the replies whose wire format depends on the
+// protocol version (RESP2 or RESP3) negotiated by the connection.
+type replyEncoder struct {
+	protocol int
+}
+
+// BulkString encodes a binary-safe string.
+func (e replyEncoder) BulkString(value string) string {
+	return fmtBulkString(value)
+}
+
+// EmptyBulk encodes an empty bulk string.
+func (e replyEncoder) EmptyBulk() string {
+	return fmtBulkString("")
+}
+
+// NullBulk encodes a null bulk string (RESP2) or a null (RESP3).
+func (e replyEncoder) NullBulk() string {
+	if e.protocol == protocolRESP3 {
+		return redisNullPrefix + redisCRLF
+	}
+
+	return fmtNullBulkString()
+}
+
+// NullArray encodes a null array (RESP2) or a null (RESP3).
+func (e replyEncoder) NullArray() string {
+	if e.protocol == protocolRESP3 {
+		return redisNullPrefix + redisCRLF
+	}
+
+	return fmt.Sprintf("%s%d%s", redisArrayPrefix, -1, redisCRLF)
+}
+
+// Array encodes already encoded elements as an array.
+func (e replyEncoder) Array(elements ...string) string {
+	return fmtAggregate(redisArrayPrefix, len(elements), elements...)
+}
+
+// ArrayOfStrings encodes strings as an array of bulk strings.
+func (e replyEncoder) ArrayOfStrings(values ...string) string {
+	return fmtArrayOfString(values...)
+}
+
+// ArrayOfBytes encodes values as an array of bulk strings, encoding nil values as nulls.
+func (e replyEncoder) ArrayOfBytes(values ...[]byte) string {
+	elements := make([]string, 0, len(values))
+	for _, value := range values {
+		if value == nil {
+			elements = append(elements, e.NullBulk())
 		} else {
-			response.WriteString(fmtBulkString(value))
+			elements = append(elements, e.BulkString(string(value)))
 		}
 	}
 
-	return response.String()
+	return e.Array(elements...)
+}
+
+// Integer encodes a signed 64-bit integer.
+func (e replyEncoder) Integer(value int64) string {
+	return fmtInt64(value)
+}
+
+// Map encodes already encoded key/value elements as a map (RESP3)
+// or as a flat array (RESP2).
+func (e replyEncoder) Map(keysValues ...string) string {
+	if e.protocol == protocolRESP3 {
+		return fmtAggregate(redisMapPrefix, len(keysValues)/2, keysValues...)
+	}
+
+	return fmtAggregate(redisArrayPrefix, len(keysValues), keysValues...)
+}
+
+// MapOfStrings encodes field/value strings as a map of bulk strings.
+func (e replyEncoder) MapOfStrings(fieldsValues ...string) string {
+	elements := make([]string, 0, len(fieldsValues))
+	for _, value := range fieldsValues {
+		elements = append(elements, fmtBulkString(value))
+	}
+
+	return e.Map(elements...)
+}
+
+// Set encodes already encoded elements as a set (RESP3) or as an array (RESP2).
+func (e replyEncoder) Set(elements ...string) string {
+	if e.protocol == protocolRESP3 {
+		return fmtAggregate(redisSetPrefix, len(elements), elements...)
+	}
+
+	return fmtAggregate(redisArrayPrefix, len(elements), elements...)
+}
+
+// Push encodes already encoded elements as an out-of-band push frame (RESP3)
+// or as an array (RESP2).
+func (e replyEncoder) Push(elements ...string) string {
+	if e.protocol == protocolRESP3 {
+		return fmtAggregate(redisPushPrefix, len(elements), elements...)
+	}
+
+	return fmtAggregate(redisArrayPrefix, len(elements), elements...)
+}
+
+// Double encodes a floating point number as a double (RESP3) or as a bulk string (RESP2).
+func (e replyEncoder) Double(value float64) string {
+	if e.protocol == protocolRESP3 {
+		return redisDoublePrefix + fmtFloat(value) + redisCRLF
+	}
+
+	return fmtBulkString(fmtFloat(value))
+}
+
+// Boolean encodes a boolean (RESP3) or an integer reply of 1 or 0 (RESP2).
+func (e replyEncoder) Boolean(value bool) string {
+	if e.protocol == protocolRESP3 {
+		if value {
+			return redisBooleanPrefix + "t" + redisCRLF
+		}
+		return redisBooleanPrefix + "f" + redisCRLF
+	}
+
+	if value {
+		return fmtInt(1)
+	}
+	return fmtInt(0)
 }